@@ -0,0 +1,211 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// Len returns the number of LEDs on the channel.
+func (channel *LEDStrandChannel) Len() int {
+	return len(channel.leds)
+}
+
+// SetPixel sets LED i to color, packed as 0xWWRRGGBB.
+func (channel *LEDStrandChannel) SetPixel(i int, color uint32) error {
+	if err := channel.checkIndex(i); err != nil {
+		return err
+	}
+	channel.leds[i] = color
+	if channel.leds16 != nil {
+		channel.leds16[i] = Color(color).Color64()
+	}
+	return nil
+}
+
+// SetPixelColor sets LED i to any color.Color, as the strip type of the
+// channel shows it, with 16 bits per component when the channel dithers.
+func (channel *LEDStrandChannel) SetPixelColor(i int, c color.Color) error {
+	if channel.leds16 == nil {
+		return channel.SetPixel(i, ColorOf(c).Pack(channel.strip_type))
+	}
+	c64 := ColorOf64(c)
+	if channel.strip_type&SK6812_SHIFT_WMASK == 0 && c64.W() != 0 {
+		r, g, b, _ := c64.RGBA()
+		c64 = RGBW64(uint16(r), uint16(g), uint16(b), 0)
+	}
+	return channel.SetPixel64(i, c64)
+}
+
+// SetPixel64 sets LED i to a 16-bit color, which is rounded to 8 bits unless
+// the channel dithers.
+func (channel *LEDStrandChannel) SetPixel64(i int, c Color64) error {
+	if err := channel.checkIndex(i); err != nil {
+		return err
+	}
+	channel.leds[i] = uint32(c.Color())
+	if channel.leds16 != nil {
+		channel.leds16[i] = c
+	}
+	return nil
+}
+
+// Pixel64 returns the 16-bit color of LED i.
+func (channel *LEDStrandChannel) Pixel64(i int) (Color64, error) {
+	if err := channel.checkIndex(i); err != nil {
+		return 0, err
+	}
+	if channel.leds16 == nil {
+		return Color(channel.leds[i]).Color64(), nil
+	}
+	return channel.leds16[i], nil
+}
+
+// Pixel returns the color of LED i, packed as 0xWWRRGGBB.
+func (channel *LEDStrandChannel) Pixel(i int) (uint32, error) {
+	if err := channel.checkIndex(i); err != nil {
+		return 0, err
+	}
+	return channel.leds[i], nil
+}
+
+// Pixels returns the LED buffer of the channel itself, colors packed as 0xWWRRGGBB.
+// Writes to it are sent by the next Render, unless the channel dithers, which
+// sends the buffer of Pixels64 instead.
+func (channel *LEDStrandChannel) Pixels() []uint32 {
+	return channel.leds
+}
+
+// Pixels64 returns the 16-bit LED buffer of the channel itself, nil unless
+// the channel dithers. Writes to it are sent by the next Render.
+func (channel *LEDStrandChannel) Pixels64() []Color64 {
+	return channel.leds16
+}
+
+// Fill sets every LED to color.
+func (channel *LEDStrandChannel) Fill(color uint32) {
+	for i := range channel.leds {
+		channel.leds[i] = color
+	}
+	for i := range channel.leds16 {
+		channel.leds16[i] = Color(color).Color64()
+	}
+}
+
+// Clear turns every LED off.
+func (channel *LEDStrandChannel) Clear() {
+	channel.Fill(0)
+}
+
+// CopyFrom copies colors into the first len(colors) LEDs.
+func (channel *LEDStrandChannel) CopyFrom(colors []uint32) error {
+	if len(colors) > len(channel.leds) {
+		return fmt.Errorf("%w: %v colors for %v LEDs", ErrOutOfRange, len(colors), len(channel.leds))
+	}
+	copy(channel.leds, colors)
+	if channel.leds16 != nil {
+		for i, color := range colors {
+			channel.leds16[i] = Color(color).Color64()
+		}
+	}
+	return nil
+}
+
+// Brightness returns the brightness the LEDs are scaled by, 255 being full brightness.
+func (channel *LEDStrandChannel) Brightness() byte {
+	return channel.brightness
+}
+
+// SetBrightness sets the brightness the LEDs are scaled by from the next Render on.
+func (channel *LEDStrandChannel) SetBrightness(brightness byte) {
+	channel.brightness = brightness
+}
+
+// SetDither makes Render send the 16-bit colors of the channel with temporal
+// dithering, so dim colors, brightness and gamma keep more than 8 bits:
+// the color sent varies from frame to frame to average the 16-bit one. The
+// more frames per second Render achieves the more bits are dithered, none
+// below 60 where it would flicker. The 16-bit colors start as the 8-bit ones.
+func (channel *LEDStrandChannel) SetDither(dither bool) {
+	channel.dither = dither
+	if !dither {
+		channel.leds16 = nil
+		channel.dither_err = nil
+		return
+	}
+	if channel.leds16 == nil && channel.leds != nil {
+		channel.leds16 = make([]Color64, len(channel.leds))
+		for i, led := range channel.leds {
+			channel.leds16[i] = Color(led).Color64()
+		}
+		channel.dither_err = make([][LED_COLOURS]int32, len(channel.leds))
+	}
+}
+
+// Dither returns whether the channel dithers.
+func (channel *LEDStrandChannel) Dither() bool {
+	return channel.dither
+}
+
+// SetGamma sets the gamma correction of every color component from the next
+// Render on, nil for none.
+func (channel *LEDStrandChannel) SetGamma(gamma *Gamma) {
+	for i := range channel.gamma {
+		channel.SetComponentGamma(Component(i), gamma)
+	}
+}
+
+// SetComponentGamma sets the gamma correction of a single color component,
+// for LEDs whose colors respond differently, nil for none.
+func (channel *LEDStrandChannel) SetComponentGamma(component Component, gamma *Gamma) error {
+	if component < 0 || component >= LED_COLOURS {
+		return ws2811_errorf(WS2811_ERROR_GENERIC, "SetComponentGamma", "invalid component %v", component)
+	}
+	if gamma == nil {
+		gamma = gamma_linear
+	}
+	channel.gamma[component] = gamma
+	return nil
+}
+
+// Gamma returns the gamma correction of a color component, nil for none.
+func (channel *LEDStrandChannel) Gamma(component Component) *Gamma {
+	if component < 0 || component >= LED_COLOURS || channel.gamma[component] == gamma_linear {
+		return nil
+	}
+	return channel.gamma[component]
+}
+
+// Layout returns how the LEDs are mounted, for displaying them.
+func (channel *LEDStrandChannel) Layout() Layout {
+	return channel.layout
+}
+
+// SetLayout sets how the LEDs are mounted, for displaying them.
+func (channel *LEDStrandChannel) SetLayout(layout Layout) {
+	channel.layout = layout
+}
+
+// SetPin sets the pin the channel is driven from, in place of the GPIO given
+// to NewLEDStrandChannel, before the strand is created. pin is a GPIO
+// ("18", "GPIO18"), a pin of the header of the board ("pin 12", "J8 pin 12",
+// "P5-6") or a function, "PWM0", "PWM1", "PCM" or "SPI0" to "SPI6", taking
+// the first GPIO broken out with it. Header pins and functions are resolved
+// for the board the strand detects, which rejects pins it doesn't have.
+func (channel *LEDStrandChannel) SetPin(pin string) error {
+	spec, err := parse_pin_spec(pin)
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_ILLEGAL_GPIO, "SetPin", err)
+	}
+	channel.pin = spec
+	if spec.gpionum >= 0 {
+		channel.gpionum = spec.gpionum
+	}
+	return nil
+}
+
+func (channel *LEDStrandChannel) checkIndex(i int) error {
+	if i < 0 || i >= len(channel.leds) {
+		return fmt.Errorf("%w: %v not in [0, %v)", ErrOutOfRange, i, len(channel.leds))
+	}
+	return nil
+}
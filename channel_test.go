@@ -0,0 +1,20 @@
+package rpiws2811
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChannelOutOfRange(t *testing.T) {
+	strand := &LEDStrand{}
+	for _, i := range []int{-1, RPI_PWM_CHANNELS} {
+		if _, err := strand.Channel(i); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("Channel(%v): error %v, want ErrOutOfRange", i, err)
+		}
+	}
+	for i := 0; i < RPI_PWM_CHANNELS; i++ {
+		if channel, err := strand.Channel(i); err != nil || channel != &strand.channel[i] {
+			t.Errorf("Channel(%v): %p, %v, want %p", i, channel, err, &strand.channel[i])
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package rpiws2811
 
+import "unsafe"
+
 // **** <clk.h> ****
 
 const (
@@ -41,6 +43,12 @@ type cm_clk_t struct {
 	div uint32
 } // TODO @jmbarzee __attribute__((packed, aligned(4)))
 
+// Register offsets in cm_clk_t
+const (
+	CM_CLK_CTL = unsafe.Offsetof(cm_clk_t{}.ctl)
+	CM_CLK_DIV = unsafe.Offsetof(cm_clk_t{}.div)
+)
+
 const (
 	// PWM and PCM clock offsets from https://www.scribd.com/doc/127599939/BCM2835-Audio-clocks
 	CM_PCM_OFFSET = (0x00101098)
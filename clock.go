@@ -0,0 +1,73 @@
+package rpiws2811
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for the driver and the Scheduler, so they can
+// run on virtual time in tests.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the time package.
+type SystemClock struct{}
+
+var _ Clock = SystemClock{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// FakeClock is a Clock on virtual time, which only passes when it is slept on
+// or advanced. Sleep and After return at once, having advanced the clock by
+// their duration, so whatever waits on a FakeClock runs deterministically and
+// as fast as it can. Advance stands for time spent working, like rendering.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock starting at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{
+		now: start,
+	}
+}
+
+// Now returns the virtual time.
+func (clock *FakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+// Advance moves the virtual time forward by d.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	if d > 0 {
+		clock.now = clock.now.Add(d)
+	}
+}
+
+// Sleep advances the virtual time by d.
+func (clock *FakeClock) Sleep(d time.Duration) {
+	clock.Advance(d)
+}
+
+// After advances the virtual time by d and returns a channel holding the new time.
+func (clock *FakeClock) After(d time.Duration) <-chan time.Time {
+	clock.Advance(d)
+
+	c := make(chan time.Time, 1)
+	c <- clock.Now()
+	return c
+}
@@ -0,0 +1,137 @@
+// Command ws2811decode decodes a captured DMA buffer back into the colors of
+// the LEDs it drives, to check what a strand actually puts on the wire.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jmbarzee/rpiws2811"
+)
+
+var driver_modes = map[string]int{
+	"pwm": rpiws2811.PWM,
+	"pcm": rpiws2811.PCM,
+	"spi": rpiws2811.SPI,
+}
+
+var strip_types = map[string]rpiws2811.LEDType{
+	"rgb":  rpiws2811.WS2811_STRIP_RGB,
+	"rbg":  rpiws2811.WS2811_STRIP_RBG,
+	"grb":  rpiws2811.WS2811_STRIP_GRB,
+	"gbr":  rpiws2811.WS2811_STRIP_GBR,
+	"brg":  rpiws2811.WS2811_STRIP_BRG,
+	"bgr":  rpiws2811.WS2811_STRIP_BGR,
+	"rgbw": rpiws2811.SK6812_STRIP_RGBW,
+	"rbgw": rpiws2811.SK6812_STRIP_RBGW,
+	"grbw": rpiws2811.SK6812_STRIP_GRBW,
+	"gbrw": rpiws2811.SK6812_STRIP_GBRW,
+	"brgw": rpiws2811.SK6812_STRIP_BRGW,
+	"bgrw": rpiws2811.SK6812_STRIP_BGRW,
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [buffer file]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "Decodes the buffer read from the file, or stdin, and prints the LED colors of each channel.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var mode, strip, strip2, vcd string
+	var freq, osc uint
+	var invert bool
+
+	flag.Usage = usage
+	flag.StringVar(&mode, "m", "pwm", "driver mode the buffer was encoded for - pwm, pcm or spi (shorthand)")
+	flag.StringVar(&mode, "mode", "pwm", "driver mode the buffer was encoded for - pwm, pcm or spi")
+	flag.UintVar(&freq, "f", uint(rpiws2811.WS2811_TARGET_FREQ), "output frequency (shorthand)")
+	flag.UintVar(&freq, "freq", uint(rpiws2811.WS2811_TARGET_FREQ), "output frequency")
+	flag.StringVar(&strip, "s", "rgb", "strip type of channel 0 - rgb, grb, ..., rgbw, grbw, ... (shorthand)")
+	flag.StringVar(&strip, "strip", "rgb", "strip type of channel 0 - rgb, grb, ..., rgbw, grbw, ...")
+	flag.StringVar(&strip2, "strip2", "", "strip type of channel 1, PWM only, defaults to the one of channel 0")
+	flag.BoolVar(&invert, "i", false, "inverted output, in the buffer for PCM and SPI, by the hardware in the VCD for PWM (shorthand)")
+	flag.BoolVar(&invert, "invert", false, "inverted output, in the buffer for PCM and SPI, by the hardware in the VCD for PWM")
+	flag.StringVar(&vcd, "vcd", "", "also write the signal to this Value Change Dump file")
+	flag.UintVar(&osc, "osc", rpiws2811.OSC_FREQ, "oscillator the PWM and PCM clocks are divided from in the VCD, 54000000 on a Pi 4")
+	flag.Parse()
+
+	waveform := rpiws2811.Waveform{
+		Freq:    uint32(freq),
+		Invert:  [rpiws2811.RPI_PWM_CHANNELS]bool{invert, invert},
+		OscFreq: uint32(osc),
+	}
+
+	var ok bool
+	waveform.DriverMode, ok = driver_modes[strings.ToLower(mode)]
+	if !ok {
+		fmt.Printf("invalid mode %s\n", mode)
+		os.Exit(-1)
+	}
+
+	if strip2 == "" {
+		strip2 = strip
+	}
+	for i, s := range []string{strip, strip2} {
+		waveform.StripType[i], ok = strip_types[strings.ToLower(s)]
+		if !ok {
+			fmt.Printf("invalid strip %s\n", s)
+			os.Exit(-1)
+		}
+	}
+
+	in := os.Stdin
+	if flag.NArg() > 0 {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		in = file
+	}
+
+	raw, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if vcd != "" {
+		if err := write_vcd(waveform, raw, vcd); err != nil {
+			fmt.Fprintf(os.Stderr, "vcd failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	leds, err := waveform.Decode(raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "decode failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	for channum, channel := range leds {
+		if waveform.DriverMode != rpiws2811.PWM && channum > 0 {
+			break
+		}
+		fmt.Printf("channel %d: %d LEDs\n", channum, len(channel))
+		for i, led := range channel {
+			fmt.Printf("%5d: 0x%08x\n", i, led)
+		}
+	}
+}
+
+func write_vcd(waveform rpiws2811.Waveform, raw []byte, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := waveform.WriteVCD(file, raw); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
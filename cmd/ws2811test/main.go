@@ -0,0 +1,369 @@
+// Command ws2811test lights a rainbow of dots rising up an LED matrix,
+// a port of the test program of the C library, to check the wiring of a board.
+// It takes the options of the C program, -h (--help) listing them and
+// -v (--version) printing the version, and more.
+//
+// The repository has no go.mod, so it builds in GOPATH mode, from a checkout
+// at $GOPATH/src/github.com/jmbarzee/rpiws2811:
+//
+//	GO111MODULE=off go build ./cmd/ws2811test
+//	sudo ./ws2811test -g 18 -s grb
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/jmbarzee/rpiws2811"
+)
+
+// defaults for cmdline options
+const (
+	TARGET_FREQ = rpiws2811.WS2811_TARGET_FREQ
+	GPIO_PIN    = 18
+	DMA         = 10
+	// STRIP_TYPE = rpiws2811.WS2811_STRIP_RGB  // WS2812/SK6812RGB integrated chip+leds
+	STRIP_TYPE = rpiws2811.WS2811_STRIP_GBR // WS2812/SK6812RGB integrated chip+leds
+	// STRIP_TYPE = rpiws2811.SK6812_STRIP_RGBW // SK6812RGBW (NOT SK6812RGB)
+
+	WIDTH  = 8
+	HEIGHT = 8
+)
+
+var strip_types = map[string]rpiws2811.LEDType{
+	"rgb":  rpiws2811.WS2811_STRIP_RGB,
+	"rbg":  rpiws2811.WS2811_STRIP_RBG,
+	"grb":  rpiws2811.WS2811_STRIP_GRB,
+	"gbr":  rpiws2811.WS2811_STRIP_GBR,
+	"brg":  rpiws2811.WS2811_STRIP_BRG,
+	"bgr":  rpiws2811.WS2811_STRIP_BGR,
+	"rgbw": rpiws2811.SK6812_STRIP_RGBW,
+	"grbw": rpiws2811.SK6812_STRIP_GRBW,
+}
+
+// version of the command, as stamped in the binary by the go command
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+type args struct {
+	gpio          int
+	pin           string
+	dma           int
+	strip_type    rpiws2811.LEDType
+	gamma         *rpiws2811.Gamma
+	white         rpiws2811.WhiteMode
+	white_temp    float64
+	dither        bool
+	width         int
+	height        int
+	invert        bool
+	clear_on_exit bool
+	simulate      bool
+	record        string
+	preview       string
+}
+
+func parseargs() args {
+	a := args{}
+	var strip string
+	var gamma string
+	var white string
+	var unused bool
+	var show_version bool
+
+	flag.IntVar(&a.gpio, "g", GPIO_PIN, "GPIO to use (shorthand)")
+	flag.IntVar(&a.gpio, "gpio", GPIO_PIN, "GPIO to use")
+	flag.StringVar(&a.pin, "p", "", "pin to use instead of the GPIO, like \"pin 12\" or PWM0 (shorthand)")
+	flag.StringVar(&a.pin, "pin", "", "pin to use instead of the GPIO, like \"pin 12\" or PWM0")
+	flag.IntVar(&a.dma, "d", DMA, "dma channel to use (shorthand)")
+	flag.IntVar(&a.dma, "dma", DMA, "dma channel to use")
+	flag.StringVar(&strip, "s", "", "strip type - rgb, rbg, grb, gbr, brg, bgr, rgbw, grbw (shorthand)")
+	flag.StringVar(&strip, "strip", "", "strip type - rgb, rbg, grb, gbr, brg, bgr, rgbw, grbw")
+	flag.StringVar(&gamma, "gamma", "", "gamma correction - srgb, cie or an exponent like 2.8")
+	flag.StringVar(&white, "white", "", "derive white of rgbw strips - none, min-subtract, accurate, boost")
+	flag.Float64Var(&a.white_temp, "whitetemp", 6500, "color temperature of the white LEDs in Kelvin")
+	flag.BoolVar(&a.dither, "dither", false, "dither the colors over frames, keeping dim colors smooth")
+	flag.IntVar(&a.width, "x", WIDTH, "matrix width (shorthand)")
+	flag.IntVar(&a.width, "width", WIDTH, "matrix width")
+	flag.IntVar(&a.height, "y", HEIGHT, "matrix height (shorthand)")
+	flag.IntVar(&a.height, "height", HEIGHT, "matrix height")
+	flag.BoolVar(&a.invert, "i", false, "invert pin output, pulse LOW (shorthand)")
+	flag.BoolVar(&a.invert, "invert", false, "invert pin output, pulse LOW")
+	flag.BoolVar(&a.clear_on_exit, "c", false, "clear matrix on exit (shorthand)")
+	flag.BoolVar(&a.clear_on_exit, "clear", false, "clear matrix on exit")
+	flag.BoolVar(&a.simulate, "sim", false, "draw the matrix on the terminal instead of driving LEDs")
+	flag.StringVar(&a.record, "record", "", "record the frames to a .png waterfall or an animated .gif")
+	flag.StringVar(&a.preview, "preview", "", "serve a live preview to browsers on this address, like :8080")
+	flag.BoolVar(&unused, "D", false, "accepted and ignored, like the C test program")
+	flag.BoolVar(&show_version, "v", false, "version information (shorthand)")
+	flag.BoolVar(&show_version, "version", false, "version information")
+	// -h and --help are those of the flag package, listing the options after the version
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s version %s\n", os.Args[0], version())
+		fmt.Fprintf(os.Stderr, "Usage: %s\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if show_version {
+		fmt.Fprintf(os.Stderr, "%s version %s\n", os.Args[0], version())
+		os.Exit(-1)
+	}
+
+	/*
+		PWM0, which can be set to use GPIOs 12, 18, 40, and 52.
+		Only 12 (pin 32) and 18 (pin 12) are available on the B+/2B/3B
+		PWM1 which can be set to use GPIOs 13, 19, 41, 45 and 53.
+		Only 13 is available on the B+/2B/PiZero/3B, on pin 33
+		PCM_DOUT, which can be set to use GPIOs 21 and 31.
+		Only 21 is available on the B+/2B/PiZero/3B, on pin 40.
+		SPI0-MOSI is available on GPIOs 10 and 38.
+		Only GPIO 10 is available on all models.
+		SPI3-MOSI to SPI6-MOSI are available on GPIOs 2, 6, 14 and 20 of the Pi 4.
+
+		The library checks if the specified gpio is broken out with one
+		of these functions on the specific model (from model B rev 1 till 4B,
+		the Zero and the Compute Modules). SetPin also takes a header
+		pin like "pin 12" or a function like "PWM1" instead.
+	*/
+
+	if a.dma < 0 || a.dma > 15 {
+		fmt.Printf("invalid dma %d\n", a.dma)
+		os.Exit(-1)
+	}
+	if ext := strings.ToLower(filepath.Ext(a.record)); a.record != "" && ext != ".png" && ext != ".gif" {
+		fmt.Printf("invalid record file %s, must be .png or .gif\n", a.record)
+		os.Exit(-1)
+	}
+	if a.height <= 0 {
+		fmt.Printf("invalid height %d\n", a.height)
+		os.Exit(-1)
+	}
+	if a.width <= 0 {
+		fmt.Printf("invalid width %d\n", a.width)
+		os.Exit(-1)
+	}
+
+	a.strip_type = STRIP_TYPE
+	if strip != "" {
+		strip_type, ok := strip_types[strings.ToLower(strip)]
+		if !ok {
+			fmt.Printf("invalid strip %s\n", strip)
+			os.Exit(-1)
+		}
+		a.strip_type = strip_type
+	}
+
+	switch strings.ToLower(gamma) {
+	case "":
+	case "srgb":
+		a.gamma = rpiws2811.NewGammaSRGB()
+	case "cie":
+		a.gamma = rpiws2811.NewGammaCIE()
+	default:
+		exponent, err := strconv.ParseFloat(gamma, 64)
+		if err == nil {
+			a.gamma, err = rpiws2811.NewGammaPower(exponent)
+		}
+		if err != nil {
+			fmt.Printf("invalid gamma %s\n", gamma)
+			os.Exit(-1)
+		}
+	}
+
+	switch strings.ToLower(white) {
+	case "", "none":
+		a.white = rpiws2811.WhiteNone
+	case "min-subtract":
+		a.white = rpiws2811.WhiteMinSubtract
+	case "accurate":
+		a.white = rpiws2811.WhiteAccurate
+	case "boost":
+		a.white = rpiws2811.WhiteBoost
+	default:
+		fmt.Printf("invalid white %s\n", white)
+		os.Exit(-1)
+	}
+
+	return a
+}
+
+type matrix struct {
+	width  int
+	height int
+	leds   []uint32
+}
+
+func (m *matrix) matrix_render(channel *rpiws2811.LEDStrandChannel) {
+	for x := 0; x < m.width; x++ {
+		for y := 0; y < m.height; y++ {
+			channel.SetPixel((y*m.width)+x, m.leds[y*m.width+x])
+		}
+	}
+}
+
+func (m *matrix) matrix_raise() {
+	for y := 0; y < (m.height - 1); y++ {
+		for x := 0; x < m.width; x++ {
+			// This is for the 8x8 Pimoroni Unicorn-HAT where the LEDS in subsequent
+			// rows are arranged in opposite directions
+			m.leds[y*m.width+x] = m.leds[(y+1)*m.width+m.width-x-1]
+		}
+	}
+}
+
+var dotspos = []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+var dotcolors = []uint32{
+	0x00200000, // red
+	0x00201000, // orange
+	0x00202000, // yellow
+	0x00002000, // green
+	0x00002020, // lightblue
+	0x00000020, // blue
+	0x00100010, // purple
+	0x00200010, // pink
+}
+
+var dotcolors_rgbw = []uint32{
+	0x00200000, // red
+	0x10200000, // red + W
+	0x00002000, // green
+	0x10002000, // green + W
+	0x00000020, // blue
+	0x10000020, // blue + W
+	0x00101010, // white
+	0x10101010, // white + W
+}
+
+func (m *matrix) matrix_bottom(strip_type rpiws2811.LEDType) {
+	for i := range dotspos {
+		dotspos[i]++
+		if dotspos[i] > (m.width - 1) {
+			dotspos[i] = 0
+		}
+
+		if strip_type == rpiws2811.SK6812_STRIP_RGBW {
+			m.leds[dotspos[i]+(m.height-1)*m.width] = dotcolors_rgbw[i]
+		} else {
+			m.leds[dotspos[i]+(m.height-1)*m.width] = dotcolors[i]
+		}
+	}
+}
+
+func main() {
+	a := parseargs()
+
+	m := &matrix{
+		width:  a.width,
+		height: a.height,
+		leds:   make([]uint32, a.width*a.height),
+	}
+
+	c1, err := rpiws2811.NewLEDStrandChannel(a.gpio, a.width*a.height, 255, a.invert, a.strip_type)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ws2811_init failed: %v\n", err)
+		os.Exit(1)
+	}
+	if a.pin != "" {
+		if err := c1.SetPin(a.pin); err != nil {
+			fmt.Fprintf(os.Stderr, "ws2811_init failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	c1.SetGamma(a.gamma)
+	c1.SetDither(a.dither)
+	if err := c1.SetWhite(a.white, a.white_temp); err != nil {
+		fmt.Fprintf(os.Stderr, "ws2811_init failed: %v\n", err)
+		os.Exit(1)
+	}
+	// The rows of the Unicorn-HAT run in opposite directions
+	c1.SetLayout(rpiws2811.Layout{Width: a.width, Serpentine: true})
+	c2, err := rpiws2811.NewLEDStrandChannel(0, 0, 0, false, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ws2811_init failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 15 frames /sec
+	sched := &rpiws2811.Scheduler{FPS: 15}
+	opts := []rpiws2811.StrandOption{rpiws2811.WithSignalHandling(), rpiws2811.WithScheduler(sched)}
+	if a.simulate {
+		opts = append(opts, rpiws2811.WithSimulator(rpiws2811.NewTerminal(os.Stdout)))
+	}
+	rec := &rpiws2811.Recorder{Scale: 8}
+	if a.record != "" {
+		opts = append(opts, rpiws2811.WithFrameSink(rec))
+	}
+	if a.preview != "" {
+		preview := rpiws2811.NewPreview()
+		go func() {
+			if err := preview.ListenAndServe(a.preview); err != nil {
+				fmt.Fprintf(os.Stderr, "preview failed: %v\n", err)
+			}
+		}()
+		opts = append(opts, rpiws2811.WithFrameSink(preview))
+	}
+
+	// Closing the strand blanks it when clear_on_exit is set, in place of matrix_clear
+	strand, err := rpiws2811.NewLEDStrand(TARGET_FREQ, a.dma, a.clear_on_exit, c1, c2, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ws2811_init failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := strand.Hardware().Mismatch; err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	err = strand.Run(context.Background(), func(strand *rpiws2811.LEDStrand) error {
+		m.matrix_raise()
+		m.matrix_bottom(a.strip_type)
+		channel, err := strand.Channel(0)
+		if err != nil {
+			return err
+		}
+		m.matrix_render(channel)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ws2811_render failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	if a.record != "" {
+		if err := record(rec, a.record); err != nil {
+			fmt.Fprintf(os.Stderr, "recording failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("\n%v\n", sched.Stats())
+}
+
+func record(rec *rpiws2811.Recorder, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".gif" {
+		err = rec.WriteGIF(file, 0)
+	} else {
+		err = rec.WritePNG(file, 0)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
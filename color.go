@@ -0,0 +1,404 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color is the color of an LED packed as 0xWWRRGGBB, the layout of the LED
+// buffers of the channels, whose strip type takes the components from it in
+// the order of the strip. It is a color.Color, the white lighting up the red,
+// green and blue.
+type Color uint32
+
+var _ color.Color = Color(0)
+
+// RGB returns the color of red, green and blue components.
+func RGB(r, g, b byte) Color {
+	return RGBW(r, g, b, 0)
+}
+
+// RGBW returns the color of red, green, blue and white components, the white
+// only lighting the white LEDs of RGBW strips.
+func RGBW(r, g, b, w byte) Color {
+	return Color(uint32(w)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b))
+}
+
+// HSV returns the color of a hue in degrees, a saturation and a value from 0 to 1.
+func HSV(h, s, v float64) Color {
+	s, v = clamp01(s), clamp01(v)
+	c := v * s
+	return hue_color(h, c, v-c)
+}
+
+// HSL returns the color of a hue in degrees, a saturation and a lightness from 0 to 1.
+func HSL(h, s, l float64) Color {
+	s, l = clamp01(s), clamp01(l)
+	c := (1 - math.Abs(2*l-1)) * s
+	return hue_color(h, c, l-c/2)
+}
+
+// Kelvin returns the color of a black body at a temperature from 1000 K to
+// 40000 K, 2700 K being the one of warm white lamps and 6500 K daylight.
+func Kelvin(k float64) Color {
+	r, g, b := kelvin_rgb(k)
+	return RGB(unit_byte(r), unit_byte(g), unit_byte(b))
+}
+
+// ParseColor parses a color given as hexadecimal digits, optionally after #
+// or 0x, rgb, rrggbb or wwrrggbb as packed in a Color, or as a CSS color name
+// like "orange".
+func ParseColor(s string) (Color, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := css_colors[name]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(name, "#"), "0x")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	switch len(hex) {
+	case 3:
+		r, g, b := byte(v>>8&0xf), byte(v>>4&0xf), byte(v&0xf)
+		return RGB(r*0x11, g*0x11, b*0x11), nil
+	case 6, 8:
+		return Color(v), nil
+	}
+	return 0, fmt.Errorf("invalid color %q, give 3, 6 or 8 hexadecimal digits", s)
+}
+
+// ColorOf converts any color.Color to the color of an LED. LEDs being off where
+// a color is transparent, the color is taken over black.
+func ColorOf(c color.Color) Color {
+	if c, ok := c.(Color); ok {
+		return c
+	}
+	r, g, b, _ := c.RGBA()
+	return RGB(byte(r>>8), byte(g>>8), byte(b>>8))
+}
+
+func (c Color) R() byte { return byte(c >> 16) }
+func (c Color) G() byte { return byte(c >> 8) }
+func (c Color) B() byte { return byte(c) }
+func (c Color) W() byte { return byte(c >> 24) }
+
+// RGBA implements color.Color, the white adding to red, green and blue.
+func (c Color) RGBA() (r, g, b, a uint32) {
+	r, g, b = led_rgb(uint32(c))
+	return r * 0x101, g * 0x101, b * 0x101, 0xffff
+}
+
+// Pack returns the color packed as 0xWWRRGGBB for the LEDs of strip, whose
+// white is added to red, green and blue when strip has no white LEDs.
+func (c Color) Pack(strip LEDType) uint32 {
+	if strip&SK6812_SHIFT_WMASK == 0 && c.W() != 0 {
+		r, g, b := led_rgb(uint32(c))
+		return uint32(RGB(byte(r), byte(g), byte(b)))
+	}
+	return uint32(c)
+}
+
+// String returns the color as #rrggbb, #wwrrggbb when it has white.
+func (c Color) String() string {
+	if c.W() != 0 {
+		return fmt.Sprintf("#%08x", uint32(c))
+	}
+	return fmt.Sprintf("#%06x", uint32(c))
+}
+
+// ColorModel returns the color.Model converting colors to those the LEDs of
+// the strip type show, as Color.
+func (strip LEDType) ColorModel() color.Model {
+	return color.ModelFunc(func(c color.Color) color.Color {
+		return Color(ColorOf(c).Pack(strip))
+	})
+}
+
+// Color64 is the color of an LED with 16 bits per component, packed as
+// 0xWWWWRRRRGGGGBBBB, for the channels which dither, see SetDither.
+type Color64 uint64
+
+var _ color.Color = Color64(0)
+
+// RGBW64 returns the color of 16-bit red, green, blue and white components.
+func RGBW64(r, g, b, w uint16) Color64 {
+	return Color64(uint64(w)<<48 | uint64(r)<<32 | uint64(g)<<16 | uint64(b))
+}
+
+// ColorOf64 converts any color.Color to the 16-bit color of an LED, taken
+// over black like ColorOf.
+func ColorOf64(c color.Color) Color64 {
+	switch c := c.(type) {
+	case Color64:
+		return c
+	case Color:
+		return c.Color64()
+	}
+	r, g, b, _ := c.RGBA()
+	return RGBW64(uint16(r), uint16(g), uint16(b), 0)
+}
+
+// Color64 returns the color with 16 bits per component.
+func (c Color) Color64() Color64 {
+	return RGBW64(uint16(c.R())*0x101, uint16(c.G())*0x101, uint16(c.B())*0x101, uint16(c.W())*0x101)
+}
+
+func (c Color64) R() uint16 { return uint16(c >> 32) }
+func (c Color64) G() uint16 { return uint16(c >> 16) }
+func (c Color64) B() uint16 { return uint16(c) }
+func (c Color64) W() uint16 { return uint16(c >> 48) }
+
+// RGBA implements color.Color, the white adding to red, green and blue.
+func (c Color64) RGBA() (r, g, b, a uint32) {
+	w := uint32(c.W())
+	rgb := [3]uint32{uint32(c.R()) + w, uint32(c.G()) + w, uint32(c.B()) + w}
+	for i := range rgb {
+		if rgb[i] > 0xffff {
+			rgb[i] = 0xffff
+		}
+	}
+	return rgb[0], rgb[1], rgb[2], 0xffff
+}
+
+// Color returns the color rounded to 8 bits per component.
+func (c Color64) Color() Color {
+	round := func(v uint16) byte { return byte((uint32(v) + 0x80) / 0x101) }
+	return RGBW(round(c.R()), round(c.G()), round(c.B()), round(c.W()))
+}
+
+/**
+ * Build a color from the chroma and lightness offset of HSV or HSL.
+ *
+ * @param    h  hue in degrees.
+ * @param    c  chroma, 0 to 1.
+ * @param    m  added to every component, 0 to 1.
+ *
+ * @returns  the color
+ */
+func hue_color(h, c, m float64) Color {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	if math.IsNaN(h) {
+		h = 0
+	}
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return RGB(unit_byte(r+m), unit_byte(g+m), unit_byte(b+m))
+}
+
+/**
+ * Approximate the color of a black body, after Tanner Helland's fit of the
+ * CIE 1964 10 degree color matching functions.
+ *
+ * @param    k  temperature in Kelvin, clamped to 1000 to 40000.
+ *
+ * @returns  red, green and blue, 0 to 1
+ */
+func kelvin_rgb(k float64) (r, g, b float64) {
+	if math.IsNaN(k) {
+		k = 6600
+	}
+	t := math.Max(1000, math.Min(40000, k)) / 100
+
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return clamp01(r / 255), clamp01(g / 255), clamp01(b / 255)
+}
+
+func clamp01(x float64) float64 {
+	if math.IsNaN(x) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, x))
+}
+
+func unit_byte(x float64) byte {
+	return byte(math.Round(clamp01(x) * 255))
+}
+
+// The named colors of CSS
+var css_colors = map[string]Color{
+	"aliceblue":            0xf0f8ff,
+	"antiquewhite":         0xfaebd7,
+	"aqua":                 0x00ffff,
+	"aquamarine":           0x7fffd4,
+	"azure":                0xf0ffff,
+	"beige":                0xf5f5dc,
+	"bisque":               0xffe4c4,
+	"black":                0x000000,
+	"blanchedalmond":       0xffebcd,
+	"blue":                 0x0000ff,
+	"blueviolet":           0x8a2be2,
+	"brown":                0xa52a2a,
+	"burlywood":            0xdeb887,
+	"cadetblue":            0x5f9ea0,
+	"chartreuse":           0x7fff00,
+	"chocolate":            0xd2691e,
+	"coral":                0xff7f50,
+	"cornflowerblue":       0x6495ed,
+	"cornsilk":             0xfff8dc,
+	"crimson":              0xdc143c,
+	"cyan":                 0x00ffff,
+	"darkblue":             0x00008b,
+	"darkcyan":             0x008b8b,
+	"darkgoldenrod":        0xb8860b,
+	"darkgray":             0xa9a9a9,
+	"darkgreen":            0x006400,
+	"darkgrey":             0xa9a9a9,
+	"darkkhaki":            0xbdb76b,
+	"darkmagenta":          0x8b008b,
+	"darkolivegreen":       0x556b2f,
+	"darkorange":           0xff8c00,
+	"darkorchid":           0x9932cc,
+	"darkred":              0x8b0000,
+	"darksalmon":           0xe9967a,
+	"darkseagreen":         0x8fbc8f,
+	"darkslateblue":        0x483d8b,
+	"darkslategray":        0x2f4f4f,
+	"darkslategrey":        0x2f4f4f,
+	"darkturquoise":        0x00ced1,
+	"darkviolet":           0x9400d3,
+	"deeppink":             0xff1493,
+	"deepskyblue":          0x00bfff,
+	"dimgray":              0x696969,
+	"dimgrey":              0x696969,
+	"dodgerblue":           0x1e90ff,
+	"firebrick":            0xb22222,
+	"floralwhite":          0xfffaf0,
+	"forestgreen":          0x228b22,
+	"fuchsia":              0xff00ff,
+	"gainsboro":            0xdcdcdc,
+	"ghostwhite":           0xf8f8ff,
+	"gold":                 0xffd700,
+	"goldenrod":            0xdaa520,
+	"gray":                 0x808080,
+	"green":                0x008000,
+	"greenyellow":          0xadff2f,
+	"grey":                 0x808080,
+	"honeydew":             0xf0fff0,
+	"hotpink":              0xff69b4,
+	"indianred":            0xcd5c5c,
+	"indigo":               0x4b0082,
+	"ivory":                0xfffff0,
+	"khaki":                0xf0e68c,
+	"lavender":             0xe6e6fa,
+	"lavenderblush":        0xfff0f5,
+	"lawngreen":            0x7cfc00,
+	"lemonchiffon":         0xfffacd,
+	"lightblue":            0xadd8e6,
+	"lightcoral":           0xf08080,
+	"lightcyan":            0xe0ffff,
+	"lightgoldenrodyellow": 0xfafad2,
+	"lightgray":            0xd3d3d3,
+	"lightgreen":           0x90ee90,
+	"lightgrey":            0xd3d3d3,
+	"lightpink":            0xffb6c1,
+	"lightsalmon":          0xffa07a,
+	"lightseagreen":        0x20b2aa,
+	"lightskyblue":         0x87cefa,
+	"lightslategray":       0x778899,
+	"lightslategrey":       0x778899,
+	"lightsteelblue":       0xb0c4de,
+	"lightyellow":          0xffffe0,
+	"lime":                 0x00ff00,
+	"limegreen":            0x32cd32,
+	"linen":                0xfaf0e6,
+	"magenta":              0xff00ff,
+	"maroon":               0x800000,
+	"mediumaquamarine":     0x66cdaa,
+	"mediumblue":           0x0000cd,
+	"mediumorchid":         0xba55d3,
+	"mediumpurple":         0x9370db,
+	"mediumseagreen":       0x3cb371,
+	"mediumslateblue":      0x7b68ee,
+	"mediumspringgreen":    0x00fa9a,
+	"mediumturquoise":      0x48d1cc,
+	"mediumvioletred":      0xc71585,
+	"midnightblue":         0x191970,
+	"mintcream":            0xf5fffa,
+	"mistyrose":            0xffe4e1,
+	"moccasin":             0xffe4b5,
+	"navajowhite":          0xffdead,
+	"navy":                 0x000080,
+	"oldlace":              0xfdf5e6,
+	"olive":                0x808000,
+	"olivedrab":            0x6b8e23,
+	"orange":               0xffa500,
+	"orangered":            0xff4500,
+	"orchid":               0xda70d6,
+	"palegoldenrod":        0xeee8aa,
+	"palegreen":            0x98fb98,
+	"paleturquoise":        0xafeeee,
+	"palevioletred":        0xdb7093,
+	"papayawhip":           0xffefd5,
+	"peachpuff":            0xffdab9,
+	"peru":                 0xcd853f,
+	"pink":                 0xffc0cb,
+	"plum":                 0xdda0dd,
+	"powderblue":           0xb0e0e6,
+	"purple":               0x800080,
+	"rebeccapurple":        0x663399,
+	"red":                  0xff0000,
+	"rosybrown":            0xbc8f8f,
+	"royalblue":            0x4169e1,
+	"saddlebrown":          0x8b4513,
+	"salmon":               0xfa8072,
+	"sandybrown":           0xf4a460,
+	"seagreen":             0x2e8b57,
+	"seashell":             0xfff5ee,
+	"sienna":               0xa0522d,
+	"silver":               0xc0c0c0,
+	"skyblue":              0x87ceeb,
+	"slateblue":            0x6a5acd,
+	"slategray":            0x708090,
+	"slategrey":            0x708090,
+	"snow":                 0xfffafa,
+	"springgreen":          0x00ff7f,
+	"steelblue":            0x4682b4,
+	"tan":                  0xd2b48c,
+	"teal":                 0x008080,
+	"thistle":              0xd8bfd8,
+	"tomato":               0xff6347,
+	"turquoise":            0x40e0d0,
+	"violet":               0xee82ee,
+	"wheat":                0xf5deb3,
+	"white":                0xffffff,
+	"whitesmoke":           0xf5f5f5,
+	"yellow":               0xffff00,
+	"yellowgreen":          0x9acd32,
+}
@@ -0,0 +1,189 @@
+package rpiws2811
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		text string
+		want Color
+		ok   bool
+	}{
+		{"f80", 0x00ff8800, true},
+		{"#F80", 0x00ff8800, true},
+		{"0xf80", 0x00ff8800, true},
+		{"ff8000", 0x00ff8000, true},
+		{"#ff8000", 0x00ff8000, true},
+		{"0XFF8000", 0x00ff8000, true},
+		{" #ff8000 ", 0x00ff8000, true},
+		{"10ff8000", 0x10ff8000, true},
+		{"#10ff8000", 0x10ff8000, true},
+		{"0x10ff8000", 0x10ff8000, true},
+		{"orange", 0x00ffa500, true},
+		{"RebeccaPurple", 0x00663399, true},
+		{"black", 0x00000000, true},
+		{"", 0, false},
+		{"#", 0, false},
+		{"0x", 0, false},
+		{"ff", 0, false},
+		{"ff80", 0, false},
+		{"ff800", 0, false},
+		{"ff80000", 0, false},
+		{"ggg", 0, false},
+		{"#-f80", 0, false},
+		{"1ff8000000", 0, false},
+		{"orangered red", 0, false},
+	}
+
+	for _, test := range tests {
+		c, err := ParseColor(test.text)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%q: %v", test.text, err)
+		case test.ok && c != test.want:
+			t.Errorf("%q: %v, want %v", test.text, c, test.want)
+		case !test.ok && err == nil:
+			t.Errorf("%q: parsed as %v", test.text, c)
+		}
+	}
+}
+
+func TestHSVAndHSL(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Color
+		want Color
+	}{
+		// The boundaries of the sectors of the hue
+		{"HSV 0", HSV(0, 1, 1), 0xff0000},
+		{"HSV 60", HSV(60, 1, 1), 0xffff00},
+		{"HSV 120", HSV(120, 1, 1), 0x00ff00},
+		{"HSV 180", HSV(180, 1, 1), 0x00ffff},
+		{"HSV 240", HSV(240, 1, 1), 0x0000ff},
+		{"HSV 300", HSV(300, 1, 1), 0xff00ff},
+		{"HSV 360", HSV(360, 1, 1), 0xff0000},
+		{"HSV -60", HSV(-60, 1, 1), 0xff00ff},
+		{"HSV 720", HSV(720, 1, 1), 0xff0000},
+		{"HSV 30", HSV(30, 1, 1), 0xff8000},
+		{"HSV 59.9", HSV(59.9, 1, 1), 0xffff00},
+		{"HSV gray", HSV(200, 0, 0.5), 0x808080},
+		{"HSV half", HSV(240, 0.5, 0.5), 0x404080},
+		{"HSV clamped", HSV(120, 2, -1), 0x000000},
+		{"HSV NaN", HSV(math.NaN(), 1, 1), 0xff0000},
+		{"HSL 0", HSL(0, 1, 0.5), 0xff0000},
+		{"HSL 60", HSL(60, 1, 0.5), 0xffff00},
+		{"HSL 120", HSL(120, 1, 0.5), 0x00ff00},
+		{"HSL 180", HSL(180, 1, 0.5), 0x00ffff},
+		{"HSL 240", HSL(240, 1, 0.5), 0x0000ff},
+		{"HSL 300", HSL(300, 1, 0.5), 0xff00ff},
+		{"HSL 360", HSL(360, 1, 0.5), 0xff0000},
+		{"HSL dark", HSL(240, 1, 0.25), 0x000080},
+		{"HSL light", HSL(0, 1, 0.75), 0xff8080},
+		{"HSL white", HSL(90, 1, 1), 0xffffff},
+		{"HSL black", HSL(90, 1, 0), 0x000000},
+	}
+
+	for _, test := range tests {
+		if test.c != test.want {
+			t.Errorf("%v: %v, want %v", test.name, test.c, test.want)
+		}
+	}
+}
+
+func TestKelvin(t *testing.T) {
+	tests := []struct {
+		k    float64
+		want Color
+	}{
+		{500, 0xff4400}, // Clamped to 1000 K
+		{1000, 0xff4400},
+		{1900, 0xff8400},
+		{2700, 0xffa757},
+		{5000, 0xffe4ce},
+		{6500, 0xfffefa},
+		{6600, 0xffffff},
+		{10000, 0xcadaff},
+		{40000, 0x98baff},
+		{100000, 0x98baff}, // Clamped to 40000 K
+	}
+
+	for _, test := range tests {
+		if c := Kelvin(test.k); c != test.want {
+			t.Errorf("%v K: %v, want %v", test.k, c, test.want)
+		}
+	}
+}
+
+func TestColorPack(t *testing.T) {
+	tests := []struct {
+		c     Color
+		strip LEDType
+		want  uint32
+	}{
+		{0x00123456, WS2811_STRIP_GRB, 0x00123456},
+		// The white lights red, green and blue of strips without white LEDs
+		{0x10203040, WS2811_STRIP_GRB, 0x00304050},
+		{0x10203040, WS2811_STRIP_RGB, 0x00304050},
+		{0x80ff8010, WS2812_STRIP, 0x00ffff90},
+		{0x10203040, SK6812_STRIP_RGBW, 0x10203040},
+		{0xff000000, SK6812W_STRIP, 0xff000000},
+	}
+
+	for _, test := range tests {
+		if packed := test.c.Pack(test.strip); packed != test.want {
+			t.Errorf("%v for %#08x: %#08x, want %#08x", test.c, uint32(test.strip), packed, test.want)
+		}
+	}
+
+	if s := Color(0xff8000).String(); s != "#ff8000" {
+		t.Errorf("String: %q, want #ff8000", s)
+	}
+	if s := Color(0x10ff8000).String(); s != "#10ff8000" {
+		t.Errorf("String: %q, want #10ff8000", s)
+	}
+}
+
+func TestColorModel(t *testing.T) {
+	tests := []struct {
+		strip LEDType
+		in    color.Color
+		want  Color
+	}{
+		{WS2811_STRIP_GRB, color.RGBA{0x12, 0x34, 0x56, 0xff}, 0x00123456},
+		{WS2811_STRIP_GRB, Color(0x00123456), 0x00123456},
+		{WS2811_STRIP_GRB, Color(0x10203040), 0x00304050},
+		{SK6812_STRIP_RGBW, Color(0x10203040), 0x10203040},
+		{SK6812_STRIP_RGBW, color.RGBA{0x12, 0x34, 0x56, 0xff}, 0x00123456},
+		// Taken over black
+		{WS2811_STRIP_GRB, color.NRGBA{0xff, 0x00, 0x80, 0x80}, 0x00800040},
+		{WS2811_STRIP_GRB, color.Transparent, 0x00000000},
+		{WS2811_STRIP_GRB, color.Gray16{0x8080}, 0x00808080},
+		{SK6812_STRIP_RGBW, RGBW64(0x1212, 0x3434, 0x5656, 0), 0x00123456},
+	}
+
+	for _, test := range tests {
+		model := test.strip.ColorModel()
+		c := model.Convert(test.in)
+		if c != test.want {
+			t.Errorf("%#08x: %#v is %v, want %v", uint32(test.strip), test.in, c, test.want)
+			continue
+		}
+
+		// The colors of the model are kept, and those without white round-trip
+		// through their RGBA, which the white adds to
+		if again := model.Convert(c); again != c {
+			t.Errorf("%#08x: %v converts to %v", uint32(test.strip), c, again)
+		}
+		if again := model.Convert(color.RGBA64Model.Convert(c)); test.want.W() == 0 && again != c {
+			t.Errorf("%#08x: %v converts back to %v", uint32(test.strip), c, again)
+		}
+		r, g, b, a := c.RGBA()
+		lr, lg, lb := led_rgb(uint32(test.want))
+		if r != lr*0x101 || g != lg*0x101 || b != lb*0x101 || a != 0xffff {
+			t.Errorf("%#08x: %v has RGBA %#04x %#04x %#04x %#04x", uint32(test.strip), c, r, g, b, a)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package rpiws2811
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Waveform describes how LEDs were encoded into a DMA buffer, to decode it.
+type Waveform struct {
+	DriverMode int                       // PWM, PCM or SPI
+	Freq       uint32                    // Output frequency the buffer was encoded for
+	StripType  [RPI_PWM_CHANNELS]LEDType // Color layout of each channel, RGB if 0
+	Invert     [RPI_PWM_CHANNELS]bool    // Inverted by software, ignored for PWM which inverts in hardware
+	OscFreq    uint32                    // Oscillator the PWM and PCM clocks are divided from, OSC_FREQ if 0
+}
+
+// Decode turns a DMA buffer back into the colors of the LEDs of each channel,
+// packed as 0xWWRRGGBB. PWM buffers hold both channels in interleaved words,
+// PCM and SPI buffers only channel 0.
+//
+// The colors are the ones on the wire, so after brightness and gamma. Every
+// channel must end with a latch gap of at least LED_RESET_uS, errors wrap
+// ErrMalformedWaveform.
+func (waveform Waveform) Decode(raw []byte) ([RPI_PWM_CHANNELS][]uint32, error) {
+	var leds [RPI_PWM_CHANNELS][]uint32
+
+	channels := 1
+	switch waveform.DriverMode {
+	case PWM:
+		channels = RPI_PWM_CHANNELS
+		if len(raw)%8 != 0 {
+			return leds, fmt.Errorf("%w: %v bytes is not a whole number of PWM word pairs", ErrMalformedWaveform, len(raw))
+		}
+	case PCM:
+		if len(raw)%4 != 0 {
+			return leds, fmt.Errorf("%w: %v bytes is not a whole number of PCM words", ErrMalformedWaveform, len(raw))
+		}
+	case SPI:
+	default:
+		return leds, fmt.Errorf("%w: unknown driver mode %v", ErrMalformedWaveform, waveform.DriverMode)
+	}
+
+	for channum := 0; channum < channels; channum++ {
+		bits := waveform_bits(raw, waveform.DriverMode, channum)
+		invert := waveform.Invert[channum] && waveform.DriverMode != PWM
+
+		var err error
+		leds[channum], err = waveform_decode_channel(bits, waveform.Freq, waveform.StripType[channum], invert)
+		if err != nil {
+			return leds, fmt.Errorf("channel %v: %w", channum, err)
+		}
+	}
+
+	return leds, nil
+}
+
+/**
+ * Extract the bit stream of a channel from a DMA buffer, in the order the
+ * bits go out on the wire.
+ *
+ * @param    raw          DMA buffer.
+ * @param    driver_mode  PWM, PCM or SPI.
+ * @param    channum      channel, only PWM has a channel 1.
+ *
+ * @returns  one bool per bit
+ */
+func waveform_bits(raw []byte, driver_mode int, channum int) []bool {
+	var bits []bool
+
+	switch driver_mode {
+	case SPI:
+		for _, b := range raw {
+			for bitpos := 7; bitpos >= 0; bitpos-- {
+				bits = append(bits, (b&(1<<uint(bitpos))) != 0)
+			}
+		}
+	default: // PWM & PCM
+		step := 1
+		if driver_mode == PWM {
+			// Every other word is on the same channel for PWM
+			step = 2
+		}
+		for wordpos := channum; wordpos*4 < len(raw); wordpos += step {
+			word := binary.LittleEndian.Uint32(raw[wordpos*4:])
+			for bitpos := 31; bitpos >= 0; bitpos-- {
+				bits = append(bits, (word&(1<<uint(bitpos))) != 0)
+			}
+		}
+	}
+
+	return bits
+}
+
+/**
+ * Decode the symbols of a channel up to its latch gap into LED colors.
+ *
+ * @param    bits        bit stream of the channel.
+ * @param    freq        output frequency.
+ * @param    strip_type  color layout of the LEDs.
+ * @param    invert      whether the symbols were inverted by software.
+ *
+ * @returns  the LED colors, error if a symbol is malformed or the latch gap missing
+ */
+func waveform_decode_channel(bits []bool, freq uint32, strip_type LEDType, invert bool) ([]uint32, error) {
+	symbol_high, symbol_low, symbol_idle := byte(SYMBOL_HIGH), byte(SYMBOL_LOW), byte(0x0)
+	if invert {
+		symbol_high, symbol_low, symbol_idle = SYMBOL_HIGH_INV, SYMBOL_LOW_INV, 0x7
+	}
+	idle_bit := invert
+
+	if strip_type == 0 {
+		strip_type = WS2811_STRIP_RGB
+	}
+	// Wire order of the color bytes, as ws2811_render sends them
+	shifts := []uint{
+		uint((strip_type >> 16) & 0xff),
+		uint((strip_type >> 8) & 0xff),
+		uint((strip_type >> 0) & 0xff),
+	}
+	if (strip_type & SK6812_SHIFT_WMASK) != 0 {
+		shifts = append(shifts, uint((strip_type>>24)&0xff))
+	}
+
+	// Symbols up to the first idle one carry the data
+	var data []byte
+	pos := 0
+	latched := false
+	for ; pos+3 <= len(bits); pos += 3 {
+		symbol := byte(0)
+		for l := 0; l < 3; l++ {
+			symbol <<= 1
+			if bits[pos+l] {
+				symbol |= 1
+			}
+		}
+
+		if symbol == symbol_idle {
+			latched = true
+			break
+		}
+
+		switch symbol {
+		case symbol_high:
+			data = append(data, 1)
+		case symbol_low:
+			data = append(data, 0)
+		default:
+			return nil, fmt.Errorf("%w: symbol %v at bit %v is %03b, neither %03b nor %03b", ErrMalformedWaveform, pos/3, pos, symbol, symbol_high, symbol_low)
+		}
+	}
+
+	if !latched && len(data) != 0 {
+		return nil, fmt.Errorf("%w: bit stream ends in the data after %v symbols, without a latch gap", ErrMalformedWaveform, len(data))
+	}
+
+	// The rest is the latch gap, which must last LED_RESET_uS
+	gap := 0
+	for ; pos < len(bits) && bits[pos] == idle_bit; pos++ {
+		gap++
+	}
+	if pos < len(bits) {
+		return nil, fmt.Errorf("%w: data resumes at bit %v after a gap of %v bits", ErrMalformedWaveform, pos, gap)
+	}
+	reset_bits := int((LED_RESET_uS * (uint64(freq) * 3)) / 1000000)
+	if len(data) != 0 && gap < reset_bits {
+		return nil, fmt.Errorf("%w: latch gap of %v bits is shorter than the %v bits of %vµs", ErrMalformedWaveform, gap, reset_bits, LED_RESET_uS)
+	}
+
+	bits_per_led := len(shifts) * 8
+	if len(data)%bits_per_led != 0 {
+		return nil, fmt.Errorf("%w: %v data bits are not a whole number of %v bit LEDs", ErrMalformedWaveform, len(data), bits_per_led)
+	}
+
+	leds := make([]uint32, len(data)/bits_per_led)
+	for i := range leds {
+		for j, shift := range shifts { // Color
+			color := uint32(0)
+			for _, bit := range data[(i*len(shifts)+j)*8:][:8] { // Bit
+				color = (color << 1) | uint32(bit)
+			}
+			leds[i] |= color << shift
+		}
+	}
+
+	return leds, nil
+}
@@ -0,0 +1,273 @@
+package rpiws2811
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	DEVICE_TREE = "/proc/device-tree"
+
+	// Bus address of the peripherals, the child address of the ranges of /soc
+	PERIPH_BUS_BASE = 0x7e000000
+)
+
+// The SoC of the compatible strings of the root of the device tree
+var dt_soc_compatible = map[string]uint32{
+	"brcm,bcm2835": RPI_SOC_BCM2835,
+	"brcm,bcm2836": RPI_SOC_BCM2836,
+	"brcm,bcm2837": RPI_SOC_BCM2837,
+	"brcm,bcm2711": RPI_SOC_BCM2711,
+	"brcm,bcm2712": RPI_SOC_BCM2712,
+}
+
+// dt_info is what the device tree tells about the board, each field only
+// valid if its flag is set.
+type dt_info struct {
+	model          string
+	soc            uint32
+	has_soc        bool
+	revision       uint32 // From /system/linux,revision
+	has_revision   bool
+	periph_base    uint32
+	has_periph     bool
+	videocore_base uint32
+	has_videocore  bool
+}
+
+/**
+ * Read a property holding big endian 32-bit cells.
+ *
+ * @param    root  root of the device tree.
+ * @param    name  path of the property from the root.
+ *
+ * @returns  the cells, error if the property can't be read or isn't made of cells
+ */
+func dt_cells(root string, name string) ([]uint32, error) {
+	b, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("%v is %v bytes, not a list of cells", name, len(b))
+	}
+
+	cells := make([]uint32, len(b)/4)
+	for i := range cells {
+		cells[i] = binary.BigEndian.Uint32(b[i*4:])
+	}
+	return cells, nil
+}
+
+/**
+ * Read the number of cells of addresses or sizes of the children of a node,
+ * the default of the devicetree specification if the node doesn't say.
+ *
+ * @param    root  root of the device tree.
+ * @param    name  path of the #address-cells or #size-cells property.
+ * @param    def   default number of cells.
+ *
+ * @returns  the number of cells
+ */
+func dt_cell_count(root string, name string, def int) int {
+	cells, err := dt_cells(root, name)
+	if err != nil || len(cells) != 1 {
+		return def
+	}
+	return int(cells[0])
+}
+
+/**
+ * Combine cells into an address, which must fit in 32 bits.
+ *
+ * @param    cells  the cells, most significant first.
+ *
+ * @returns  the address, ok false if it doesn't fit
+ */
+func dt_address(cells []uint32) (uint32, bool) {
+	for _, cell := range cells[:len(cells)-1] {
+		if cell != 0 {
+			return 0, false
+		}
+	}
+	return cells[len(cells)-1], true
+}
+
+/**
+ * Find the physical address the peripherals are mapped at in the ranges of
+ * /soc, like bcm_host_get_peripheral_address.
+ *
+ * @param    root  root of the device tree.
+ *
+ * @returns  the peripheral base, error if there is none
+ */
+func dt_periph_base(root string) (uint32, error) {
+	ranges, err := dt_cells(root, "soc/ranges")
+	if err != nil {
+		return 0, err
+	}
+
+	child_cells := dt_cell_count(root, "soc/#address-cells", 2)
+	parent_cells := dt_cell_count(root, "#address-cells", 2)
+	size_cells := dt_cell_count(root, "soc/#size-cells", 1)
+	entry := child_cells + parent_cells + size_cells
+	if child_cells < 1 || parent_cells < 1 || entry > len(ranges) {
+		return 0, fmt.Errorf("soc/ranges has %v cells, not entries of %v+%v+%v", len(ranges), child_cells, parent_cells, size_cells)
+	}
+
+	for i := 0; i+entry <= len(ranges); i += entry {
+		child, ok := dt_address(ranges[i : i+child_cells])
+		if !ok || child != PERIPH_BUS_BASE {
+			continue
+		}
+		parent, ok := dt_address(ranges[i+child_cells : i+child_cells+parent_cells])
+		if !ok {
+			return 0, fmt.Errorf("peripherals are mapped above 4GB")
+		}
+		return parent, nil
+	}
+	return 0, fmt.Errorf("soc/ranges doesn't map %#x", PERIPH_BUS_BASE)
+}
+
+/**
+ * Read what the device tree tells about the board: its model and SoC, its
+ * revision code, the physical address of its peripherals and the bus alias of
+ * the VideoCore memory, like bcm_host_get_sdram_address.
+ *
+ * @param    root  root of the device tree, normally /proc/device-tree.
+ *
+ * @returns  the information found, error if there is no device tree at root
+ */
+func dt_detect(root string) (*dt_info, error) {
+	if _, err := os.Stat(filepath.Join(root, "compatible")); err != nil {
+		return nil, err
+	}
+	dt := &dt_info{}
+
+	if model, err := os.ReadFile(filepath.Join(root, "model")); err == nil {
+		dt.model = string(bytes.TrimRight(model, "\x00"))
+	}
+
+	if compatible, err := os.ReadFile(filepath.Join(root, "compatible")); err == nil {
+		for _, name := range bytes.Split(compatible, []byte{0}) {
+			if soc, ok := dt_soc_compatible[string(name)]; ok {
+				dt.soc, dt.has_soc = soc, true
+				break
+			}
+		}
+	}
+
+	if cells, err := dt_cells(root, "system/linux,revision"); err == nil && len(cells) == 1 {
+		dt.revision, dt.has_revision = cells[0], true
+	}
+
+	if base, err := dt_periph_base(root); err == nil {
+		dt.periph_base, dt.has_periph = base, true
+	}
+
+	// reg of vc_mem is its start, its size and the alias it is seen through
+	if cells, err := dt_cells(root, "axi/vc_mem/reg"); err == nil && len(cells) == 3 {
+		dt.videocore_base, dt.has_videocore = cells[2], true
+	}
+
+	return dt, nil
+}
+
+/**
+ * Describe a board from its device tree alone, for the boards whose revision
+ * code is unknown.
+ *
+ * @param    dt  what the device tree tells.
+ *
+ * @returns  the board, ok false if the device tree doesn't tell enough
+ */
+func rpi_hw_from_dt(dt *dt_info) (*rpi_hw_t, bool) {
+	if !dt.has_soc || !dt.has_periph {
+		return nil, false
+	}
+
+	rpi := &rpi_hw_t{
+		soc:         dt.soc,
+		periph_base: dt.periph_base,
+		desc:        dt.model,
+	}
+	switch dt.soc {
+	case RPI_SOC_BCM2835:
+		rpi.typeNum = RPI_HWVER_TYPE_PI1
+		rpi.videocore_base = VIDEOCORE_BASE_RPI
+	case RPI_SOC_BCM2836, RPI_SOC_BCM2837:
+		rpi.typeNum = RPI_HWVER_TYPE_PI2
+		rpi.videocore_base = VIDEOCORE_BASE_RPI2
+	case RPI_SOC_BCM2711:
+		rpi.typeNum = RPI_HWVER_TYPE_PI4
+		rpi.videocore_base = VIDEOCORE_BASE_RPI4
+	default:
+		return nil, false
+	}
+	if dt.has_videocore {
+		rpi.videocore_base = dt.videocore_base
+	}
+	if rpi.desc == "" {
+		rpi.desc = rpi_soc_names[dt.soc] + " board"
+	}
+	return rpi, true
+}
+
+/**
+ * Detect the board from its revision code, in cpuinfo or else in the device
+ * tree, and take the peripheral base and the VideoCore alias from the device
+ * tree when it has them. Where the device tree and the revision code disagree
+ * the device tree wins, as it describes the running kernel, and the
+ * disagreement is kept in the mismatch of the board.
+ *
+ * @param    cpuinfo_path  path of cpuinfo, normally /proc/cpuinfo.
+ * @param    dt_root       root of the device tree, "" not to use one.
+ *
+ * @returns  the board on success, error if it isn't known or supported
+ */
+func rpi_hw_detect_dt(cpuinfo_path string, dt_root string) (*rpi_hw_t, error) {
+	rpi_hw, err := rpi_hw_detect(cpuinfo_path)
+	if dt_root == "" {
+		return rpi_hw, err
+	}
+	dt, dt_err := dt_detect(dt_root)
+	if dt_err != nil {
+		return rpi_hw, err
+	}
+
+	if err != nil {
+		if !dt.has_revision {
+			if rpi, ok := rpi_hw_from_dt(dt); ok {
+				return rpi, nil
+			}
+			return nil, err
+		}
+		rpi_hw, err = rpi_hw_from_revision(dt.revision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var mismatches []error
+	if dt.has_soc && dt.soc != rpi_hw.soc {
+		mismatches = append(mismatches, fmt.Errorf("device tree has a %v, revision %#x a %v", rpi_soc_names[dt.soc], rpi_hw.hwver, rpi_soc_names[rpi_hw.soc]))
+	}
+	if dt.has_revision && dt.revision != rpi_hw.hwver {
+		mismatches = append(mismatches, fmt.Errorf("device tree has revision %#x, cpuinfo %#x", dt.revision, rpi_hw.hwver))
+	}
+	if dt.has_periph && dt.periph_base != rpi_hw.periph_base {
+		mismatches = append(mismatches, fmt.Errorf("device tree has the peripherals at %#x, revision %#x at %#x", dt.periph_base, rpi_hw.hwver, rpi_hw.periph_base))
+		rpi_hw.periph_base = dt.periph_base
+	}
+	if dt.has_videocore && dt.videocore_base != rpi_hw.videocore_base {
+		mismatches = append(mismatches, fmt.Errorf("device tree has the VideoCore alias %#x, revision %#x %#x", dt.videocore_base, rpi_hw.hwver, rpi_hw.videocore_base))
+		rpi_hw.videocore_base = dt.videocore_base
+	}
+	rpi_hw.mismatch = errors.Join(mismatches...)
+
+	return rpi_hw, nil
+}
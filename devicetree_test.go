@@ -0,0 +1,71 @@
+package rpiws2811
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceTree(t *testing.T) {
+	tests := []struct {
+		device_tree string
+		cpuinfo     string
+		periph_base uint32
+		vc_base     uint32
+		model       string
+		mismatch    string // Part of the mismatch, "" for none
+	}{
+		{"pi3b", "pi3b", 0x3f000000, 0xc0000000, "Pi 3 Model B Rev 1.2, 1GB, Sony UK", ""},
+		{"pi4b", "pi4b", 0xfe000000, 0xc0000000, "Pi 4 Model B Rev 1.1, 4GB, Sony UK", ""},
+		{"cm4", "cm4", 0xfe000000, 0xc0000000, "Compute Module 4 Rev 1.0, 1GB, Sony UK", ""},
+		// The revision code of the device tree stands in for the one of cpuinfo
+		{"cm4", "no-revision", 0xfe000000, 0xc0000000, "Compute Module 4 Rev 1.0, 1GB, Sony UK", ""},
+		// soc/ranges puts the peripherals of this Pi 3 at 0x3e000000
+		{"pi3b-ranges", "pi3b", 0x3e000000, 0xc0000000, "Pi 3 Model B Rev 1.2, 1GB, Sony UK", "peripherals at 0x3e000000"},
+	}
+
+	for _, test := range tests {
+		name := test.device_tree + "/" + test.cpuinfo
+		mem := NewFakeMemory(test.periph_base)
+		vc := NewFakeVideoCore()
+		c1, err := NewLEDStrandChannel(18, 4, 255, false, WS2811_STRIP_GRB)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+			WithCPUInfo(filepath.Join("testdata", "cpuinfo", test.cpuinfo)),
+			WithDeviceTree(filepath.Join("testdata", "devicetree", test.device_tree)),
+			WithPeripheralMemory(mem),
+			WithVideoCore(vc),
+			WithClock(NewFakeClock(time.Unix(0, 0))))
+		if err != nil {
+			t.Errorf("%v: NewLEDStrand: %v", name, err)
+			continue
+		}
+
+		hw := strand.Hardware()
+		if hw.PeriphBase != test.periph_base || hw.VideoCoreBase != test.vc_base || hw.Model != test.model {
+			t.Errorf("%v: %#x, %#x, %q, want %#x, %#x, %q", name,
+				hw.PeriphBase, hw.VideoCoreBase, hw.Model, test.periph_base, test.vc_base, test.model)
+		}
+		switch {
+		case test.mismatch == "" && hw.Mismatch != nil:
+			t.Errorf("%v: mismatch %v", name, hw.Mismatch)
+		case test.mismatch != "" && (hw.Mismatch == nil || !strings.Contains(hw.Mismatch.Error(), test.mismatch)):
+			t.Errorf("%v: mismatch %v, want one with %q", name, hw.Mismatch, test.mismatch)
+		}
+
+		// The registers were mapped at the base of the device tree
+		pwm_rng1 := test.periph_base + PWM_OFFSET + uint32(PWM_RNG1)
+		if rng := mem.Read32(pwm_rng1); rng != 32 {
+			t.Errorf("%v: PWM RNG1 at %#x is %v, want 32", name, pwm_rng1, rng)
+		}
+
+		if err := strand.Close(); err != nil {
+			t.Errorf("%v: Close: %v", name, err)
+		}
+		vc.Check(t)
+	}
+}
@@ -0,0 +1,148 @@
+package rpiws2811
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Slowest a dithering cycle may repeat without flickering to the eye. A
+	// fraction of 1/2^n of a step takes cycles of 2^n frames, so the frame rate
+	// bounds the bits dithered.
+	DITHER_CYCLE_HZ = 30
+	// Most bits dithered below the 8 sent
+	DITHER_MAX_BITS = 8
+	// Pause between renders after which the frame rate is measured over and
+	// the dithering errors forgotten
+	DITHER_RESET_TIME = time.Second
+)
+
+/**
+ * Measure the frame rate Render achieves, as a moving average of the time
+ * between renders, and forget the dithering errors after a pause.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ * @param    now     time of this render.
+ *
+ * @returns  None
+ */
+func dither_track_rate(strand *LEDStrand, now time.Time) {
+	last := strand.last_render
+	strand.last_render = now
+	if last.IsZero() {
+		return
+	}
+
+	interval := now.Sub(last)
+	if interval <= 0 {
+		return
+	}
+	if interval > DITHER_RESET_TIME {
+		strand.frame_rate = 0
+		for i := range strand.channel {
+			dither_reset(&strand.channel[i])
+		}
+		return
+	}
+
+	rate := float64(time.Second) / float64(interval)
+	if strand.frame_rate == 0 {
+		strand.frame_rate = rate
+		return
+	}
+	strand.frame_rate += (rate - strand.frame_rate) / 16
+}
+
+/**
+ * Forget the dithering errors of a channel, so its next frame sends the
+ * colors rounded rather than carrying errors over.
+ *
+ * @param    channel  channel instance pointer.
+ *
+ * @returns  None
+ */
+func dither_reset(channel *LEDStrandChannel) {
+	for i := range channel.dither_err {
+		channel.dither_err[i] = [LED_COLOURS]int32{}
+	}
+}
+
+/**
+ * Find how many bits below the 8 sent can be dithered at a frame rate
+ * without visible flicker.
+ *
+ * @param    frame_rate  frames per second, 0 if unknown.
+ *
+ * @returns  the bits, 0 for none
+ */
+func dither_bits(frame_rate float64) uint {
+	if frame_rate < 2*DITHER_CYCLE_HZ {
+		return 0
+	}
+	bits := uint(math.Log2(frame_rate / DITHER_CYCLE_HZ))
+	if bits > DITHER_MAX_BITS {
+		bits = DITHER_MAX_BITS
+	}
+	return bits
+}
+
+/**
+ * Quantize a 16-bit component to the 8 bits sent, carrying the error over to
+ * the next frame so the average over frames is the 16-bit value.
+ *
+ * @param    err   error carried between frames, in 1/256 of a step.
+ * @param    v     component, 0 to 0xffff.
+ * @param    bits  bits dithered.
+ *
+ * @returns  the component to send
+ */
+func dither_quantize(err *int32, v uint32, bits uint) byte {
+	// The component in 1/256 of a step, rounded once to the fraction dithered
+	unit := int32(1) << (DITHER_MAX_BITS - bits)
+	target := int32((v*0x100+0x101*uint32(unit)/2)/(0x101*uint32(unit))) * unit
+
+	acc := target + *err
+	out := (acc + 0x80) >> 8
+	if out < 0 {
+		out = 0
+	} else if out > 0xff {
+		out = 0xff
+	}
+
+	*err = acc - out<<8
+	if *err < -0x80 {
+		*err = -0x80
+	} else if *err > 0x80 {
+		*err = 0x80
+	}
+	return byte(out)
+}
+
+/**
+ * Compute the colors of an LED of a dithering channel from its 16-bit color,
+ * in the order of the strip.
+ *
+ * @param    channel  channel instance pointer.
+ * @param    i        LED.
+ * @param    gamma    gamma correction of each color, in the order of the strip.
+ * @param    scale    brightness plus one.
+ * @param    white    whether to derive the white from red, green and blue.
+ * @param    bits     bits dithered.
+ *
+ * @returns  the colors to send
+ */
+func dither_led(channel *LEDStrandChannel, i int, gamma [LED_COLOURS]*Gamma, scale uint32, white bool, bits uint) [LED_COLOURS]byte {
+	led := channel.leds16[i]
+	c := [LED_COLOURS]uint32{uint32(led.R()), uint32(led.G()), uint32(led.B()), uint32(led.W())}
+	if white {
+		white_extract_components(channel.white_mode, channel.white, &c, 0xffff)
+	}
+
+	var color [LED_COLOURS]byte
+	shifts := [LED_COLOURS]byte{channel.rshift, channel.gshift, channel.bshift, channel.wshift}
+	for j, shift := range shifts {
+		v := (c[shift_component(shift)] * scale) >> 8
+		color[j] = dither_quantize(&channel.dither_err[i][j], gamma_correct16(gamma[j], v), bits)
+	}
+	return color
+}
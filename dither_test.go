@@ -0,0 +1,327 @@
+package rpiws2811
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCloseClearsDithering(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	strand, _, vc := fake_strand(t, 18, true, WithClock(clock))
+
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel.SetDither(true)
+	for i := 0; i < channel.Len(); i++ {
+		if err := channel.SetPixel64(i, RGBW64(0x0180, 0x8040, 0xff7f, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 500 frames per second dither 4 bits, leaving errors to carry over
+	for frame := 0; frame < 20; frame++ {
+		if err := strand.Render(); err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		clock.Advance(2 * time.Millisecond)
+	}
+	if bits := dither_bits(strand.FrameRate()); bits == 0 {
+		t.Fatalf("not dithering at %v frames per second", strand.FrameRate())
+	}
+
+	// The buffer of the fake memory outlives the strand
+	raw := strand.Raw()
+	waveform := strand.Waveform()
+	if err := strand.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	vc.Check(t)
+
+	leds, err := waveform.Decode(raw)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i, led := range leds[0] {
+		if led != 0 {
+			t.Errorf("LED %v is %08x after Close, want 0", i, led)
+		}
+	}
+}
+
+// 16-bit colors between the 8-bit steps, and both ends
+var dither_colors = []Color64{
+	RGBW64(0x0180, 0x8040, 0xff7f, 0),
+	RGBW64(0x0001, 0x1234, 0x7fff, 0),
+	RGBW64(0x0000, 0xffff, 0x00c0, 0),
+	RGBW64(0x4321, 0x0101, 0xfe80, 0),
+}
+
+/**
+ * Create a dithering strand of the colors of dither_colors.
+ *
+ * @param    t      test.
+ * @param    clock  clock of the strand.
+ *
+ * @returns  the strand, its channel and its VideoCore
+ */
+func dither_strand(t *testing.T, clock *FakeClock) (*LEDStrand, *LEDStrandChannel, *FakeVideoCore) {
+	t.Helper()
+
+	strand, _, vc := fake_strand(t, 18, false, WithClock(clock))
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel.SetDither(true)
+	for i, color := range dither_colors {
+		if err := channel.SetPixel64(i, color); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return strand, channel, vc
+}
+
+/**
+ * Render a frame when it is due and decode the components sent. Render
+ * itself takes time, waiting for the LEDs to latch the previous frame, so
+ * frames are due at times rather than after intervals.
+ *
+ * @param    t       test.
+ * @param    strand  strand.
+ * @param    clock   clock of the strand.
+ * @param    due     when to render, now if it is past.
+ *
+ * @returns  red, green and blue of each LED of channel 0
+ */
+func dither_render(t *testing.T, strand *LEDStrand, clock *FakeClock, due time.Time) [][3]uint32 {
+	t.Helper()
+
+	if wait := due.Sub(clock.Now()); wait > 0 {
+		clock.Advance(wait)
+	}
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	leds, err := strand.Waveform().Decode(strand.Raw())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	components := make([][3]uint32, len(leds[0]))
+	for i, led := range leds[0] {
+		components[i] = [3]uint32{(led >> 16) & 0xff, (led >> 8) & 0xff, led & 0xff}
+	}
+	return components
+}
+
+func TestDitherConvergence(t *testing.T) {
+	for _, interval := range []time.Duration{2 * time.Millisecond, time.Millisecond, 500 * time.Microsecond} {
+		clock := NewFakeClock(time.Unix(0, 0))
+		strand, _, vc := dither_strand(t, clock)
+		start := clock.Now()
+
+		// The frame rate is known from the second frame on
+		frame := 0
+		for ; frame < 2; frame++ {
+			dither_render(t, strand, clock, start.Add(time.Duration(frame)*interval))
+		}
+		bits := dither_bits(strand.FrameRate())
+		if bits == 0 {
+			t.Fatalf("%v: not dithering at %v frames per second", interval, strand.FrameRate())
+		}
+
+		// A cycle of 2^bits frames averages the 16-bit color, to the error
+		// carried in and out of it, at most a step over the cycle
+		frames := 1 << bits
+		sums := make([][3]uint32, len(dither_colors))
+		for end := frame + frames; frame < end; frame++ {
+			for i, components := range dither_render(t, strand, clock, start.Add(time.Duration(frame)*interval)) {
+				for j := range components {
+					sums[i][j] += components[j]
+				}
+			}
+		}
+		for i, color := range dither_colors {
+			for j, v := range []uint16{color.R(), color.G(), color.B()} {
+				average := float64(sums[i][j]) * 0x101 / float64(frames)
+				if math.Abs(average-float64(v)) > 0x101/float64(frames)+1 {
+					t.Errorf("%v, %v bits: LED %v component %v averages %.1f over %v frames, want %#04x", interval, bits, i, j, average, frames, v)
+				}
+			}
+		}
+
+		if err := strand.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		vc.Check(t)
+	}
+
+	// Render can't reach the frame rates of 7 and 8 bits with the latch of the
+	// LEDs, the quantization converges all the same
+	for bits := uint(1); bits <= DITHER_MAX_BITS; bits++ {
+		frames := 1 << bits
+		for _, v := range []uint32{0x0001, 0x0180, 0x1234, 0x7fff, 0xfe80, 0xffff} {
+			var err int32
+			sum := 0
+			for frame := 0; frame < frames; frame++ {
+				sum += int(dither_quantize(&err, v, bits))
+			}
+			average := float64(sum) * 0x101 / float64(frames)
+			if math.Abs(average-float64(v)) > 0x101/float64(frames)+1 {
+				t.Errorf("%v bits: %#04x averages %.1f over %v frames", bits, v, average, frames)
+			}
+		}
+	}
+}
+
+func TestDitherBits(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		bits     uint
+	}{
+		{40 * time.Millisecond, 0}, // 25 fps
+		{20 * time.Millisecond, 0}, // 50 fps
+		{16 * time.Millisecond, 1}, // 62.5 fps
+		{8 * time.Millisecond, 2},
+		{4 * time.Millisecond, 3},
+		{2 * time.Millisecond, 4},
+		{time.Millisecond, 5},
+		{500 * time.Microsecond, 6}, // 2000 fps
+	}
+
+	for _, test := range tests {
+		clock := NewFakeClock(time.Unix(0, 0))
+		strand, _, vc := dither_strand(t, clock)
+		start := clock.Now()
+
+		// The colors sent by LED and component over the frames
+		seen := make([][3]map[uint32]bool, len(dither_colors))
+		for i := range seen {
+			for j := range seen[i] {
+				seen[i][j] = map[uint32]bool{}
+			}
+		}
+		for frame := 0; frame < 32; frame++ {
+			components := dither_render(t, strand, clock, start.Add(time.Duration(frame)*test.interval))
+			if frame < 2 {
+				continue
+			}
+			for i := range components {
+				for j, v := range components[i] {
+					seen[i][j][v] = true
+				}
+			}
+		}
+
+		rate := float64(time.Second) / float64(test.interval)
+		if math.Abs(strand.FrameRate()-rate) > rate*1e-9 {
+			t.Errorf("%v: frame rate %v, want %v", test.interval, strand.FrameRate(), rate)
+		}
+		if bits := dither_bits(strand.FrameRate()); bits != test.bits {
+			t.Errorf("%v: %v bits dithered, want %v", test.interval, bits, test.bits)
+		}
+		// 0x0180 is between two steps, 0xffff a step
+		if n := len(seen[0][0]); (test.bits == 0) != (n == 1) {
+			t.Errorf("%v: %v values sent for %#04x at %v bits", test.interval, n, dither_colors[0].R(), test.bits)
+		}
+		if n := len(seen[2][1]); n != 1 || !seen[2][1][0xff] {
+			t.Errorf("%v: %v sent for 0xffff, want only 0xff", test.interval, seen[2][1])
+		}
+
+		if err := strand.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		vc.Check(t)
+	}
+
+	// The rate is a moving average, moving 1/16 of the way to a new one
+	clock := NewFakeClock(time.Unix(0, 0))
+	strand, _, vc := dither_strand(t, clock)
+	start := clock.Now()
+	for frame := 0; frame < 4; frame++ {
+		dither_render(t, strand, clock, start.Add(time.Duration(frame)*2*time.Millisecond))
+	}
+	dither_render(t, strand, clock, start.Add(10*time.Millisecond))
+	if rate, want := strand.FrameRate(), 500+(250-500)/16.0; rate != want {
+		t.Errorf("frame rate %v after a frame of 4ms at 500 fps, want %v", rate, want)
+	}
+
+	// Render waits for the LEDs to latch, 300µs after the 120µs of 4 LEDs,
+	// which bounds the frame rate and so the bits
+	for frame := 0; frame < 256; frame++ {
+		dither_render(t, strand, clock, clock.Now().Add(100*time.Microsecond))
+	}
+	latch := float64(time.Second) / float64(420*time.Microsecond)
+	if rate := strand.FrameRate(); rate > latch || dither_bits(rate) != 6 {
+		t.Errorf("frame rate %v rendering every 100µs, want 6 bits at most %v", rate, latch)
+	}
+	strand.Close()
+	vc.Check(t)
+
+	// Without a limit to the frame rate, the bits are capped
+	for _, test := range []struct {
+		rate float64
+		bits uint
+	}{
+		{0, 0}, {59.9, 0}, {60, 1}, {3840, 7}, {7679, 7}, {7680, DITHER_MAX_BITS}, {1e6, DITHER_MAX_BITS},
+	} {
+		if bits := dither_bits(test.rate); bits != test.bits {
+			t.Errorf("%v fps: %v bits, want %v", test.rate, bits, test.bits)
+		}
+	}
+}
+
+func TestDitherResetAfterPause(t *testing.T) {
+	tests := []struct {
+		pause time.Duration
+		reset bool
+	}{
+		{900 * time.Millisecond, false},
+		{DITHER_RESET_TIME, false},
+		{DITHER_RESET_TIME + time.Millisecond, true},
+		{5 * time.Second, true},
+	}
+
+	for _, test := range tests {
+		clock := NewFakeClock(time.Unix(0, 0))
+		strand, channel, vc := dither_strand(t, clock)
+		start := clock.Now()
+
+		// 500 frames per second dither 4 bits, leaving errors to carry over
+		for frame := 0; frame < 20; frame++ {
+			dither_render(t, strand, clock, start.Add(time.Duration(frame)*2*time.Millisecond))
+		}
+		components := dither_render(t, strand, clock, start.Add(38*time.Millisecond+test.pause))
+
+		carried := false
+		for i := range channel.dither_err {
+			carried = carried || channel.dither_err[i] != [LED_COLOURS]int32{}
+		}
+		if !test.reset {
+			if !carried || strand.FrameRate() == 0 {
+				t.Errorf("%v: dithering reset at %v frames per second, errors %v", test.pause, strand.FrameRate(), channel.dither_err)
+			}
+		} else {
+			if rate := strand.FrameRate(); rate != 0 {
+				t.Errorf("%v: frame rate %v after the pause, want 0", test.pause, rate)
+			}
+			if carried {
+				t.Errorf("%v: errors %v carried over the pause", test.pause, channel.dither_err)
+			}
+			// The first frame after the pause sends the colors rounded
+			for i, color := range dither_colors {
+				c := color.Color()
+				if want := [3]uint32{uint32(c.R()), uint32(c.G()), uint32(c.B())}; components[i] != want {
+					t.Errorf("%v: LED %v is %02x after the pause, want %02x", test.pause, i, components[i], want)
+				}
+			}
+		}
+
+		if err := strand.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		vc.Check(t)
+	}
+}
@@ -1,5 +1,7 @@
 package rpiws2811
 
+import "unsafe"
+
 // **** <dma.h> ****
 
 /*
@@ -10,8 +12,8 @@ package rpiws2811
  */
 type dma_cb_t struct {
 	ti         uint32
-	source_ad  uintptr
-	dest_ad    uintptr
+	source_ad  uint32
+	dest_ad    uint32
 	txfr_len   uint32
 	stride     uint32
 	nextconbk  uint32
@@ -79,6 +81,19 @@ type dma_t struct {
 	debug     uint32
 } // TODO @jmbarzee  __attribute__((packed, aligned(4)))
 
+// Register offsets in dma_t
+const (
+	DMA_CS        = unsafe.Offsetof(dma_t{}.cs)
+	DMA_CONBLK_AD = unsafe.Offsetof(dma_t{}.conblk_ad)
+	DMA_TI        = unsafe.Offsetof(dma_t{}.ti)
+	DMA_SOURCE_AD = unsafe.Offsetof(dma_t{}.source_ad)
+	DMA_DEST_AD   = unsafe.Offsetof(dma_t{}.dest_ad)
+	DMA_TXFR_LEN  = unsafe.Offsetof(dma_t{}.txfr_len)
+	DMA_STRIDE    = unsafe.Offsetof(dma_t{}.stride)
+	DMA_NEXTCONBK = unsafe.Offsetof(dma_t{}.nextconbk)
+	DMA_DEBUG     = unsafe.Offsetof(dma_t{}.debug)
+)
+
 func RPI_DMA_TXFR_LEN_YLENGTH(val int) int { return (val & 0xffff) << 16 }
 func RPI_DMA_TXFR_LEN_XLENGTH(val int) int { return (val & 0xffff) << 0 }
 
@@ -133,10 +148,36 @@ var dma_offset = []uint32{
 }
 
 func dmanum_to_offset(dmanum int) uint32 {
-	if dmanum >= len(dma_offset) {
+	if dmanum < 0 || dmanum >= len(dma_offset) {
 		return 0
 	}
 	return dma_offset[dmanum]
 }
 
+// DMA4 engines of the BCM2711, with 40-bit addresses and another register layout
+const (
+	DMA4_FIRST = 11
+	DMA4_LAST  = 14
+)
+
+/**
+ * Check the driver can program a DMA channel of the board. All the channels
+ * of the BCM2835 to 2837 share a register layout, channel 15 sitting apart from
+ * the others, but channels 11 to 14 of the BCM2711 are DMA4 engines.
+ *
+ * @param    rpi_hw  board.
+ * @param    dmanum  DMA channel.
+ *
+ * @returns  nil if the channel can be used, error otherwise
+ */
+func dma_check(rpi_hw *rpi_hw_t, dmanum int) error {
+	if dmanum_to_offset(dmanum) == 0 {
+		return ws2811_errorf(WS2811_ERROR_DMA, "dma_check", "no DMA channel %v", dmanum)
+	}
+	if rpi_hw.soc == RPI_SOC_BCM2711 && dmanum >= DMA4_FIRST && dmanum <= DMA4_LAST {
+		return ws2811_errorf(WS2811_ERROR_DMA, "dma_check", "DMA channel %v of the %v is a DMA4 engine, use one of 0 to %v or 15", dmanum, rpi_hw.desc, DMA4_FIRST-1)
+	}
+	return nil
+}
+
 // **** </dma.h> ****
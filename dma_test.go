@@ -0,0 +1,55 @@
+package rpiws2811
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDMACheck(t *testing.T) {
+	pi3, err := rpi_hw_detect("testdata/cpuinfo/pi3b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi4, err := rpi_hw_detect("testdata/cpuinfo/pi4b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for dmanum := -1; dmanum <= 16; dmanum++ {
+		valid := dmanum >= 0 && dmanum <= 15
+		dma4 := dmanum >= DMA4_FIRST && dmanum <= DMA4_LAST
+
+		if err := dma_check(pi3, dmanum); valid != (err == nil) {
+			t.Errorf("Pi 3 DMA %v: %v", dmanum, err)
+		}
+		err := dma_check(pi4, dmanum)
+		if valid && !dma4 && err != nil {
+			t.Errorf("Pi 4 DMA %v: %v", dmanum, err)
+		}
+		if (!valid || dma4) && !errors.Is(err, ErrDMA) {
+			t.Errorf("Pi 4 DMA %v: error %v, want ErrDMA", dmanum, err)
+		}
+	}
+}
+
+func TestNewLEDStrandDMA4(t *testing.T) {
+	mem := NewFakeMemory(PERIPH_BASE_RPI4)
+	vc := NewFakeVideoCore()
+	c1, err := NewLEDStrandChannel(18, 4, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewLEDStrand(WS2811_TARGET_FREQ, DMA4_FIRST, false, c1, LEDStrandChannel{},
+		WithCPUInfo("testdata/cpuinfo/pi4b"),
+		WithDeviceTree(""),
+		WithPeripheralMemory(mem),
+		WithVideoCore(vc))
+	if !errors.Is(err, ErrDMA) {
+		t.Errorf("NewLEDStrand: error %v, want ErrDMA", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped", n)
+	}
+	vc.Check(t)
+}
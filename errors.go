@@ -0,0 +1,78 @@
+package rpiws2811
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Sentinel errors matching the ws2811_return_t codes of the C library.
+// Errors returned by this package wrap one of them, test with errors.Is.
+var (
+	ErrGeneric        error = WS2811_ERROR_GENERIC
+	ErrOutOfMemory    error = WS2811_ERROR_OUT_OF_MEMORY
+	ErrHWNotSupported error = WS2811_ERROR_HW_NOT_SUPPORTED
+	ErrMemLock        error = WS2811_ERROR_MEM_LOCK
+	ErrMMap           error = WS2811_ERROR_MMAP
+	ErrMapRegisters   error = WS2811_ERROR_MAP_REGISTERS
+	ErrGPIOInit       error = WS2811_ERROR_GPIO_INIT
+	ErrPWMSetup       error = WS2811_ERROR_PWM_SETUP
+	ErrMailbox        error = WS2811_ERROR_MAILBOX_DEVICE
+	ErrDMA            error = WS2811_ERROR_DMA
+	ErrIllegalGPIO    error = WS2811_ERROR_ILLEGAL_GPIO
+	ErrPCMSetup       error = WS2811_ERROR_PCM_SETUP
+	ErrSPISetup       error = WS2811_ERROR_SPI_SETUP
+	ErrSPITransfer    error = WS2811_ERROR_SPI_TRANSFER
+
+	// ErrClosed is returned when using a strand after Close.
+	ErrClosed = errors.New("strand is closed")
+	// ErrOutOfRange is returned when addressing an LED past the end of a channel.
+	ErrOutOfRange = errors.New("LED index out of range")
+	// ErrMalformedWaveform is returned when decoding a DMA buffer which isn't a valid frame.
+	ErrMalformedWaveform = errors.New("malformed waveform")
+)
+
+func (returnCode ws2811_return_t) Error() string {
+	return getWS2811ReturnMessage(returnCode)
+}
+
+// Error describes the step of the driver which failed.
+//
+// It unwraps to both its Code and its underlying Err, so errors.Is works
+// against the sentinel errors as well as against the syscall errors.
+type Error struct {
+	Code  error         // One of the sentinel errors
+	Step  string        // The step which failed, e.g. "mem_lock"
+	Errno syscall.Errno // Underlying errno, 0 if the failure wasn't a syscall
+	Err   error         // Underlying error, may be nil
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v: %v", e.Step, e.Code)
+	}
+	return fmt.Sprintf("%v: %v: %v", e.Step, e.Code, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Code}
+	}
+	return []error{e.Code, e.Err}
+}
+
+// ws2811_error wraps err as the failure of step, reporting it as code.
+func ws2811_error(code ws2811_return_t, step string, err error) error {
+	e := &Error{
+		Code: code,
+		Step: step,
+		Err:  err,
+	}
+	errors.As(err, &e.Errno)
+	return e
+}
+
+// ws2811_errorf reports the failure of step as code with a formatted cause.
+func ws2811_errorf(code ws2811_return_t, step string, format string, a ...interface{}) error {
+	return ws2811_error(code, step, fmt.Errorf(format, a...))
+}
@@ -0,0 +1,188 @@
+package rpiws2811
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// FakeMemory is a PeripheralMemory backed by plain memory, to run the driver
+// off a Pi and check the registers it programs.
+//
+// Every register write is logged, and just enough of the hardware is emulated
+// for the driver never to wait forever: a clock is BUSY while it is enabled, a
+// DMA transfer completes as soon as it is started and the PCM TX FIFO is
+// always empty.
+type FakeMemory struct {
+	periph_base uint32
+
+	mu      sync.Mutex
+	regions []*fake_regs
+	writes  []RegisterWrite
+}
+
+// RegisterWrite is a write to a register of a FakeMemory.
+type RegisterWrite struct {
+	Addr  uint32 // Physical address of the register
+	Value uint32 // Value written, before any emulated side effect
+}
+
+var _ PeripheralMemory = (*FakeMemory)(nil)
+
+// NewFakeMemory returns a FakeMemory emulating the peripherals at periphBase,
+// which is 0x20000000 on a Pi 1, 0x3f000000 on a Pi 2 or 3 and 0xfe000000 on
+// a Pi 4.
+func NewFakeMemory(periphBase uint32) *FakeMemory {
+	return &FakeMemory{
+		periph_base: periphBase,
+	}
+}
+
+// Map returns size bytes of zeroed memory standing in for the memory at addr.
+// Like mmap, it fails to map nothing.
+func (mem *FakeMemory) Map(addr uint32, size uintptr) (Registers, error) {
+	if size == 0 {
+		return nil, ws2811_errorf(WS2811_ERROR_MMAP, "mapmem", "nothing to map at %#x", addr)
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	// Backed by words so registers and DMA control blocks are aligned
+	regs := &fake_regs{
+		mem:   mem,
+		addr:  addr,
+		words: make([]uint32, (size+3)/4),
+	}
+	mem.regions = append(mem.regions, regs)
+	return regs, nil
+}
+
+// Read32 returns the register at the physical address addr, as the driver
+// would read it, or 0 if it isn't mapped.
+func (mem *FakeMemory) Read32(addr uint32) uint32 {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	// The latest mapping wins if the same memory is mapped twice
+	for i := len(mem.regions) - 1; i >= 0; i-- {
+		regs := mem.regions[i]
+		if addr >= regs.addr && addr-regs.addr < uint32(len(regs.words)*4) {
+			return regs.words[(addr-regs.addr)/4]
+		}
+	}
+	return 0
+}
+
+// Writes returns every register write so far, oldest first.
+func (mem *FakeMemory) Writes() []RegisterWrite {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	return append([]RegisterWrite(nil), mem.writes...)
+}
+
+// ClearWrites forgets the register writes so far.
+func (mem *FakeMemory) ClearWrites() {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.writes = nil
+}
+
+// Mapped returns the number of ranges mapped and not unmapped yet, 0 once a
+// strand has released everything.
+func (mem *FakeMemory) Mapped() int {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	return len(mem.regions)
+}
+
+/**
+ * Emulate the side effects of writing a register.
+ *
+ * @param    addr  physical address of the register.
+ * @param    val   value written.
+ *
+ * @returns  the value the register reads back as
+ */
+func (mem *FakeMemory) emulate(addr uint32, val uint32) uint32 {
+	reg := addr - mem.periph_base
+
+	switch reg {
+	case CM_PWM_OFFSET + uint32(CM_CLK_CTL), CM_PCM_OFFSET + uint32(CM_CLK_CTL):
+		// The password doesn't read back, the clock runs while enabled and not killed
+		val &^= CM_CLK_CTL_PASSWD | CM_CLK_CTL_BUSY
+		if (val&CM_CLK_CTL_ENAB) != 0 && (val&CM_CLK_CTL_KILL) == 0 {
+			val |= CM_CLK_CTL_BUSY
+		}
+		return val
+	case CM_PWM_OFFSET + uint32(CM_CLK_DIV), CM_PCM_OFFSET + uint32(CM_CLK_DIV):
+		return val &^ CM_CLK_DIV_PASSWD
+	case PCM_OFFSET + uint32(PCM_CS):
+		// Clearing the FIFO is immediate, and it is always drained
+		return (val &^ RPI_PCM_CS_TXCLR) | RPI_PCM_CS_TXE
+	}
+
+	for _, offset := range dma_offset {
+		if reg != offset+uint32(DMA_CS) {
+			continue
+		}
+		if (val & RPI_DMA_CS_RESET) != 0 {
+			return 0
+		}
+		// END and INT are cleared by writing 1, a started transfer ends at once
+		val &^= RPI_DMA_CS_ABORT | RPI_DMA_CS_END | RPI_DMA_CS_INT
+		if (val & RPI_DMA_CS_ACTIVE) != 0 {
+			val = (val &^ RPI_DMA_CS_ACTIVE) | RPI_DMA_CS_END
+		}
+		return val
+	}
+
+	return val
+}
+
+// fake_regs is a range of a FakeMemory.
+type fake_regs struct {
+	mem   *FakeMemory
+	addr  uint32
+	words []uint32
+}
+
+func (regs *fake_regs) Read32(offset uintptr) uint32 {
+	regs.mem.mu.Lock()
+	defer regs.mem.mu.Unlock()
+
+	return regs.words[offset/4]
+}
+
+func (regs *fake_regs) Write32(offset uintptr, val uint32) {
+	mem := regs.mem
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	addr := regs.addr + uint32(offset)
+	mem.writes = append(mem.writes, RegisterWrite{
+		Addr:  addr,
+		Value: val,
+	})
+	regs.words[offset/4] = mem.emulate(addr, val)
+}
+
+func (regs *fake_regs) Pointer() unsafe.Pointer {
+	return unsafe.Pointer(&regs.words[0])
+}
+
+func (regs *fake_regs) Unmap() error {
+	mem := regs.mem
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for i, mapped := range mem.regions {
+		if mapped == regs {
+			mem.regions = append(mem.regions[:i], mem.regions[i+1:]...)
+			return nil
+		}
+	}
+	return ws2811_errorf(WS2811_ERROR_MMAP, "unmapmem", "%#x is not mapped", regs.addr)
+}
@@ -0,0 +1,57 @@
+package rpiws2811
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFakeMemoryPi4(t *testing.T) {
+	mem := NewFakeMemory(PERIPH_BASE_RPI4)
+	vc := NewFakeVideoCore()
+	c1, err := NewLEDStrandChannel(18, 4, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+		WithCPUInfo("testdata/cpuinfo/pi4b"),
+		WithDeviceTree(""),
+		WithPeripheralMemory(mem),
+		WithVideoCore(vc),
+		WithClock(NewFakeClock(time.Unix(0, 0))))
+	if err != nil {
+		t.Fatalf("NewLEDStrand: %v", err)
+	}
+
+	// 54 MHz / 3 clocks per symbol / 800 kHz, rounded down
+	cm_div := PERIPH_BASE_RPI4 + CM_PWM_OFFSET + uint32(CM_CLK_DIV)
+	if div := mem.Read32(cm_div); div != CM_CLK_DIV_DIVI(22) {
+		t.Errorf("CM_PWMDIV %#08x, want %#08x", div, CM_CLK_DIV_DIVI(22))
+	}
+
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	dma_cs := PERIPH_BASE_RPI4 + dmanum_to_offset(10) + uint32(DMA_CS)
+	if cs := mem.Read32(dma_cs); cs&RPI_DMA_CS_END == 0 {
+		t.Errorf("DMA CS %#08x, the transfer never ended", cs)
+	}
+
+	if err := strand.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Close", n)
+	}
+	vc.Check(t)
+}
+
+func TestFakeMemoryMapEmpty(t *testing.T) {
+	mem := NewFakeMemory(PERIPH_BASE_RPI2)
+	if _, err := mem.Map(PERIPH_BASE_RPI2, 0); !errors.Is(err, ErrMMap) {
+		t.Errorf("Map of 0 bytes: error %v, want ErrMMap", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges mapped", n)
+	}
+}
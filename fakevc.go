@@ -0,0 +1,310 @@
+package rpiws2811
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	// The memory the fake firmware allocates from, below the peripherals of every board
+	FAKE_VC_MEM_BASE = 0x1c000000
+	FAKE_VC_MEM_SIZE = 0x04000000
+
+	// Status the fake firmware replies to a bad unlock, release or QPU request
+	FAKE_VC_STATUS_ERROR = 0x80000000
+)
+
+// Bus address aliases of the VideoCore, selected by bits 2 and 3 of the
+// allocation flags: normal, direct, coherent and L1 non-allocating.
+var fake_vc_alias = [4]uint32{0x00000000, 0xc0000000, 0x80000000, 0x40000000}
+
+// FakeVideoCore is a VideoCore answering the memory, code and QPU property
+// messages (tags 0x3000c to 0x30012) in process, to run the driver without a Pi.
+//
+// Allocations get handles and bus addresses the way the firmware hands them
+// out, locks are counted and bad requests get error replies. Leaks reports
+// whatever was never released, so a test can fail on it with Check, and
+// FailTag makes requests fail to test the error paths of the driver.
+type FakeVideoCore struct {
+	mu          sync.Mutex
+	next_handle uint32
+	allocs      map[uint32]*fake_vc_alloc // by handle
+	open        int                       // mailboxes not closed yet
+	qpu_enabled bool
+	failing     map[uint32]bool // tags answered with an error
+}
+
+// fake_vc_alloc is a memory allocation of a FakeVideoCore.
+type fake_vc_alloc struct {
+	addr  uint32 // Physical address
+	size  uint32
+	flags uint32
+	locks int
+}
+
+// TestingT is the part of testing.TB used by FakeVideoCore.Check.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+var _ VideoCore = (*FakeVideoCore)(nil)
+
+// NewFakeVideoCore returns a FakeVideoCore with 64MB of memory to allocate.
+func NewFakeVideoCore() *FakeVideoCore {
+	return &FakeVideoCore{
+		next_handle: 1,
+		allocs:      map[uint32]*fake_vc_alloc{},
+		failing:     map[uint32]bool{},
+	}
+}
+
+// FailTag makes every later request of tag fail, as the firmware fails a bad
+// one: allocating replies no handle, locking no bus address, executing code
+// goes unanswered and the others get an error status, without changing
+// anything.
+func (vc *FakeVideoCore) FailTag(tag uint32) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	vc.failing[tag] = true
+}
+
+// Open opens a mailbox to the fake firmware.
+func (vc *FakeVideoCore) Open() (Mailbox, error) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	vc.open++
+	return &fake_vc_mailbox{
+		vc: vc,
+	}, nil
+}
+
+// Leaks returns an error describing every allocation not released and every
+// mailbox not closed, nil if there are none.
+func (vc *FakeVideoCore) Leaks() error {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	var errs []error
+	handles := make([]uint32, 0, len(vc.allocs))
+	for handle := range vc.allocs {
+		handles = append(handles, handle)
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i] < handles[j] })
+	for _, handle := range handles {
+		alloc := vc.allocs[handle]
+		errs = append(errs, fmt.Errorf("handle %#x of %v bytes at %#x was never released (locked %v times)", handle, alloc.size, alloc.addr, alloc.locks))
+	}
+	if vc.open > 0 {
+		errs = append(errs, fmt.Errorf("%v mailboxes were never closed", vc.open))
+	}
+	return errors.Join(errs...)
+}
+
+// Check fails t if anything leaked, to be deferred or passed to t.Cleanup
+// once the strands using the FakeVideoCore are closed.
+func (vc *FakeVideoCore) Check(t TestingT) {
+	t.Helper()
+	if err := vc.Leaks(); err != nil {
+		t.Errorf("FakeVideoCore leaks:\n%v", err)
+	}
+}
+
+/**
+ * Find room for an allocation, first fit in the fake memory.
+ *
+ * @param    size   bytes to allocate.
+ * @param    align  alignment, a power of two.
+ *
+ * @returns  physical address, ok false when there is no room
+ */
+func (vc *FakeVideoCore) find_room(size uint32, align uint32) (uint32, bool) {
+	allocs := make([]*fake_vc_alloc, 0, len(vc.allocs))
+	for _, alloc := range vc.allocs {
+		allocs = append(allocs, alloc)
+	}
+	sort.Slice(allocs, func(i, j int) bool { return allocs[i].addr < allocs[j].addr })
+
+	addr := (uint64(FAKE_VC_MEM_BASE) + uint64(align) - 1) &^ (uint64(align) - 1)
+	for _, alloc := range allocs {
+		if addr+uint64(size) <= uint64(alloc.addr) {
+			break
+		}
+		if end := uint64(alloc.addr) + uint64(alloc.size); end > addr {
+			addr = (end + uint64(align) - 1) &^ (uint64(align) - 1)
+		}
+	}
+	if addr+uint64(size) > FAKE_VC_MEM_BASE+FAKE_VC_MEM_SIZE {
+		return 0, false
+	}
+	return uint32(addr), true
+}
+
+/**
+ * Answer one tag of a property message.
+ *
+ * @param    tag    tag id.
+ * @param    value  value buffer of the tag, overwritten with the reply.
+ *
+ * @returns  size of the reply in bytes, ok false to leave the tag unanswered,
+ *           for an unknown tag, a value buffer too small for it or code
+ *           failing to execute
+ */
+func (vc *FakeVideoCore) property_tag(tag uint32, value []uint32) (uint32, bool) {
+	sizes := map[uint32]int{
+		MBOX_TAG_ALLOCATE_MEMORY: 3,
+		MBOX_TAG_LOCK_MEMORY:     1,
+		MBOX_TAG_UNLOCK_MEMORY:   1,
+		MBOX_TAG_RELEASE_MEMORY:  1,
+		MBOX_TAG_EXECUTE_CODE:    7,
+		MBOX_TAG_EXECUTE_QPU:     4,
+		MBOX_TAG_ENABLE_QPU:      1,
+	}
+	if size, ok := sizes[tag]; !ok || len(value) < size {
+		return 0, false
+	}
+
+	if vc.failing[tag] {
+		// Whatever the code returns is a valid reply
+		if tag == MBOX_TAG_EXECUTE_CODE {
+			return 0, false
+		}
+		value[0] = FAKE_VC_STATUS_ERROR
+		if tag == MBOX_TAG_ALLOCATE_MEMORY || tag == MBOX_TAG_LOCK_MEMORY {
+			value[0] = 0
+		}
+		return 4, true
+	}
+
+	switch tag {
+	case MBOX_TAG_ALLOCATE_MEMORY: // size, alignment, flags -> handle, 0 on failure
+		size, align, flags := value[0], value[1], value[2]
+		if align == 0 {
+			align = 1
+		}
+		value[0] = 0
+		if size == 0 || (align&(align-1)) != 0 {
+			break
+		}
+		addr, ok := vc.find_room(size, align)
+		if !ok {
+			break
+		}
+		handle := vc.next_handle
+		vc.next_handle++
+		vc.allocs[handle] = &fake_vc_alloc{
+			addr:  addr,
+			size:  size,
+			flags: flags,
+		}
+		value[0] = handle
+
+	case MBOX_TAG_LOCK_MEMORY: // handle -> bus address, 0 on failure
+		alloc, ok := vc.allocs[value[0]]
+		value[0] = 0
+		if ok {
+			alloc.locks++
+			value[0] = fake_vc_alias[(alloc.flags>>2)&0x3] | alloc.addr
+		}
+
+	case MBOX_TAG_UNLOCK_MEMORY: // handle -> status, 0 on success
+		alloc, ok := vc.allocs[value[0]]
+		value[0] = FAKE_VC_STATUS_ERROR
+		if ok && alloc.locks > 0 {
+			alloc.locks--
+			value[0] = 0
+		}
+
+	case MBOX_TAG_RELEASE_MEMORY: // handle -> status, 0 on success
+		alloc, ok := vc.allocs[value[0]]
+		status := uint32(FAKE_VC_STATUS_ERROR)
+		// Releasing locked memory would leave the DMA controller reading freed memory
+		if ok && alloc.locks == 0 {
+			delete(vc.allocs, value[0])
+			status = 0
+		}
+		value[0] = status
+
+	case MBOX_TAG_EXECUTE_CODE: // code, r0-r5 -> r0, nothing is run
+		value[0] = 0
+
+	case MBOX_TAG_EXECUTE_QPU: // num_qpus, control, noflush, timeout -> status, 0 on success
+		num_qpus := value[0]
+		value[0] = FAKE_VC_STATUS_ERROR
+		if vc.qpu_enabled && num_qpus >= 1 && num_qpus <= 12 {
+			value[0] = 0
+		}
+
+	case MBOX_TAG_ENABLE_QPU: // enable -> status, 0 on success
+		vc.qpu_enabled = value[0] != 0
+		value[0] = 0
+	}
+
+	return 4, true
+}
+
+// fake_vc_mailbox is a mailbox opened on a FakeVideoCore.
+type fake_vc_mailbox struct {
+	vc     *FakeVideoCore
+	closed bool
+}
+
+func (mbox *fake_vc_mailbox) Property(buf []uint32) error {
+	vc := mbox.vc
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if mbox.closed {
+		return os.ErrClosed
+	}
+
+	// The message starts with its size in bytes and the request code
+	if len(buf) < 3 || buf[0]%4 != 0 || int(buf[0]/4) < 3 || int(buf[0]/4) > len(buf) || buf[1] != MBOX_REQUEST {
+		if len(buf) > 1 {
+			buf[1] = MBOX_RESPONSE_ERROR
+		}
+		return nil
+	}
+	words := buf[:buf[0]/4]
+
+	// Tags are an id, the size of the value buffer, the size of the request and the value buffer
+	pos := 2
+	for words[pos] != 0 {
+		if pos+3 > len(words) || pos+3+int(words[pos+1]+3)/4 > len(words) {
+			buf[1] = MBOX_RESPONSE_ERROR
+			return nil
+		}
+		value := words[pos+3 : pos+3+int(words[pos+1]+3)/4]
+
+		if size, ok := vc.property_tag(words[pos], value); ok {
+			words[pos+2] = MBOX_TAG_RESPONSE | size
+		}
+
+		pos += 3 + len(value)
+		if pos >= len(words) { // no end tag
+			buf[1] = MBOX_RESPONSE_ERROR
+			return nil
+		}
+	}
+
+	buf[1] = MBOX_RESPONSE_SUCCESS
+	return nil
+}
+
+func (mbox *fake_vc_mailbox) Close() error {
+	vc := mbox.vc
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if mbox.closed {
+		return os.ErrClosed
+	}
+	mbox.closed = true
+	vc.open--
+	return nil
+}
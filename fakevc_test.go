@@ -0,0 +1,62 @@
+package rpiws2811
+
+import (
+	"errors"
+	"testing"
+)
+
+// failing_memory is a FakeMemory failing to map a range of addresses.
+type failing_memory struct {
+	*FakeMemory
+	lo, hi uint32 // Addresses failing, hi excluded
+}
+
+func (mem *failing_memory) Map(addr uint32, size uintptr) (Registers, error) {
+	if addr >= mem.lo && addr < mem.hi {
+		return nil, errors.New("mapping failed")
+	}
+	return mem.FakeMemory.Map(addr, size)
+}
+
+func TestNewLEDStrandMailboxFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		tag    uint32 // Tag failing, 0 for none
+		lo, hi uint32 // Addresses failing to map
+		want   error
+	}{
+		{name: "alloc", tag: MBOX_TAG_ALLOCATE_MEMORY, want: ErrOutOfMemory},
+		{name: "lock", tag: MBOX_TAG_LOCK_MEMORY, want: ErrMemLock},
+		{name: "map", lo: FAKE_VC_MEM_BASE, hi: FAKE_VC_MEM_BASE + FAKE_VC_MEM_SIZE},
+		{name: "map registers", lo: PERIPH_BASE_RPI2, hi: PERIPH_BASE_RPI2 + 0x01000000},
+	}
+
+	for _, test := range tests {
+		mem := &failing_memory{FakeMemory: NewFakeMemory(PERIPH_BASE_RPI2), lo: test.lo, hi: test.hi}
+		vc := NewFakeVideoCore()
+		if test.tag != 0 {
+			vc.FailTag(test.tag)
+		}
+		c1, err := NewLEDStrandChannel(18, 4, 255, false, WS2811_STRIP_GRB)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+			WithCPUInfo("testdata/cpuinfo/pi3b"),
+			WithDeviceTree(""),
+			WithPeripheralMemory(mem),
+			WithVideoCore(vc))
+		if err == nil {
+			strand.Close()
+			t.Errorf("%v: NewLEDStrand succeeded", test.name)
+		} else if test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%v: NewLEDStrand: %v, want %v", test.name, err, test.want)
+		}
+
+		if n := mem.Mapped(); n != 0 {
+			t.Errorf("%v: %v ranges still mapped", test.name, n)
+		}
+		vc.Check(t)
+	}
+}
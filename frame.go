@@ -0,0 +1,80 @@
+package rpiws2811
+
+import (
+	"errors"
+	"time"
+)
+
+// FrameSink receives every frame a strand renders, see WithFrameSink.
+type FrameSink interface {
+	// Frame is called by Render once the frame is encoded. The frame must not
+	// be modified, it is shared by every sink of the strand.
+	Frame(frame Frame) error
+}
+
+// Frame is what a strand sent to its LEDs in one Render.
+type Frame struct {
+	Time     time.Time                // When the frame was rendered
+	Waveform Waveform                 // How the LEDs were encoded into Raw
+	Raw      []byte                   // Copy of the DMA buffer, as sent on the wire
+	Layout   [RPI_PWM_CHANNELS]Layout // Layout of the LEDs of each channel
+	Count    [RPI_PWM_CHANNELS]int    // Number of LEDs of each channel
+}
+
+// LEDs decodes the colors of the LEDs of each channel from the frame, packed as
+// 0xWWRRGGBB after brightness and gamma.
+func (frame Frame) LEDs() ([RPI_PWM_CHANNELS][]uint32, error) {
+	return frame.Waveform.Decode(frame.Raw)
+}
+
+/**
+ * Pass the frame just encoded into the DMA buffer to every frame sink.
+ *
+ * @param    ws2811     ws2811 instance pointer.
+ * @param    timestamp  time of the render.
+ *
+ * @returns  nil on success, otherwise the errors of every sink which failed
+ */
+func ws2811_send_frame(strand *LEDStrand, timestamp time.Time) error {
+	if len(strand.sinks) == 0 {
+		return nil
+	}
+
+	frame := Frame{
+		Time:     timestamp,
+		Waveform: strand.Waveform(),
+		Raw:      append([]byte(nil), strand.Raw()...),
+	}
+	for i, channel := range strand.channel {
+		frame.Layout[i] = channel.layout
+		frame.Count[i] = channel.count
+	}
+
+	var errs []error
+	for _, sink := range strand.sinks {
+		errs = append(errs, sink.Frame(frame))
+	}
+	return errors.Join(errs...)
+}
+
+/**
+ * Mix the white of an LED into its red, green and blue.
+ *
+ * @param    led  color packed as 0xWWRRGGBB.
+ *
+ * @returns  red, green and blue
+ */
+func led_rgb(led uint32) (r, g, b uint32) {
+	w := (led >> 24) & 0xff
+	rgb := [3]uint32{
+		(led>>16)&0xff + w,
+		(led>>8)&0xff + w,
+		(led>>0)&0xff + w,
+	}
+	for i := range rgb {
+		if rgb[i] > 0xff {
+			rgb[i] = 0xff
+		}
+	}
+	return rgb[0], rgb[1], rgb[2]
+}
@@ -0,0 +1,153 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"math"
+)
+
+// Component is a color component of an LED, whatever order its strip takes
+// the components in.
+type Component int
+
+const (
+	ComponentRed Component = iota
+	ComponentGreen
+	ComponentBlue
+	ComponentWhite
+)
+
+var component_names = [LED_COLOURS]string{"red", "green", "blue", "white"}
+
+func (component Component) String() string {
+	if component < 0 || component >= LED_COLOURS {
+		return fmt.Sprintf("Component(%d)", int(component))
+	}
+	return component_names[component]
+}
+
+/**
+ * Find the component of 0xWWRRGGBB a shift of the strip type takes a color from.
+ *
+ * @param    shift  shift of the strip type.
+ *
+ * @returns  the component
+ */
+func shift_component(shift byte) Component {
+	switch shift {
+	case 24:
+		return ComponentWhite
+	case 16:
+		return ComponentRed
+	case 8:
+		return ComponentGreen
+	default:
+		return ComponentBlue
+	}
+}
+
+// Gamma is a gamma correction curve, mapping the value of a color component
+// after brightness to the one sent to the LED. It is kept with 16 bits of
+// precision, so the curves stay smooth where they are flat.
+type Gamma struct {
+	table [256]uint16 // Output of each 8-bit input, 0xffff for full
+}
+
+// Linear, uncorrected curve of the components without one
+var gamma_linear = gamma_curve(func(x float64) float64 { return x })
+
+/**
+ * Sample a curve mapping [0, 1] onto itself into a gamma table.
+ *
+ * @param    curve  the curve.
+ *
+ * @returns  the gamma correction
+ */
+func gamma_curve(curve func(x float64) float64) *Gamma {
+	gamma := &Gamma{}
+	for i := range gamma.table {
+		y := curve(float64(i) / 255)
+		y = math.Max(0, math.Min(1, y))
+		gamma.table[i] = uint16(math.Round(y * 0xffff))
+	}
+	return gamma
+}
+
+// NewGammaPower returns the power-law curve out = in^exponent, 2.2 to 2.8
+// suiting most LEDs. An exponent of 1 is uncorrected.
+func NewGammaPower(exponent float64) (*Gamma, error) {
+	if !(exponent > 0) || math.IsInf(exponent, 0) {
+		return nil, ws2811_errorf(WS2811_ERROR_GENERIC, "NewGammaPower", "invalid exponent %v", exponent)
+	}
+	return gamma_curve(func(x float64) float64 { return math.Pow(x, exponent) }), nil
+}
+
+// NewGammaSRGB returns the sRGB transfer function, which makes LEDs match
+// sRGB colors such as those of images and CSS.
+func NewGammaSRGB() *Gamma {
+	return gamma_curve(func(x float64) float64 {
+		if x <= 0.04045 {
+			return x / 12.92
+		}
+		return math.Pow((x+0.055)/1.055, 2.4)
+	})
+}
+
+// NewGammaCIE returns the curve of CIE 1931 lightness, along which fades look
+// even to the eye.
+func NewGammaCIE() *Gamma {
+	return gamma_curve(func(x float64) float64 {
+		l := x * 100
+		if l <= 8 {
+			return l / 903.3
+		}
+		return math.Pow((l+16)/116, 3)
+	})
+}
+
+// NewGammaTable returns the curve of a lookup table of 256 entries, the
+// output for each input.
+func NewGammaTable(table []byte) (*Gamma, error) {
+	if len(table) != len(Gamma{}.table) {
+		return nil, ws2811_errorf(WS2811_ERROR_GENERIC, "NewGammaTable", "table has %v entries, not 256", len(table))
+	}
+	gamma := &Gamma{}
+	for i, v := range table {
+		gamma.table[i] = uint16(v) * 0x101
+	}
+	return gamma, nil
+}
+
+// Correct returns the output of the curve for v.
+func (gamma *Gamma) Correct(v byte) byte {
+	return gamma_correct8(gamma, uint32(v))
+}
+
+/**
+ * Correct an 8-bit value, rounding to the nearest output.
+ *
+ * @param    gamma  gamma correction.
+ * @param    v      value, 0 to 255.
+ *
+ * @returns  the corrected value
+ */
+func gamma_correct8(gamma *Gamma, v uint32) byte {
+	return byte((uint32(gamma.table[v]) + 0x80) / 0x101)
+}
+
+/**
+ * Correct a 16-bit value, interpolating between the entries of the table.
+ *
+ * @param    gamma  gamma correction.
+ * @param    v      value, 0 to 0xffff.
+ *
+ * @returns  the corrected value, 0 to 0xffff
+ */
+func gamma_correct16(gamma *Gamma, v uint32) uint32 {
+	pos := v * 0xff
+	i, frac := pos/0xffff, int64(pos%0xffff)
+	if i >= 0xff {
+		return uint32(gamma.table[0xff])
+	}
+	lo, hi := int64(gamma.table[i]), int64(gamma.table[i+1])
+	return uint32(lo + (hi-lo)*frac/0xffff)
+}
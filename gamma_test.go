@@ -0,0 +1,169 @@
+package rpiws2811
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestGammaCurves(t *testing.T) {
+	table := make([]byte, 256)
+	for i := range table {
+		table[i] = byte(255 - i)
+	}
+	power, err := NewGammaPower(2.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linear, err := NewGammaPower(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverted, err := NewGammaTable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 16-bit outputs of the inputs 0, 1, 10, 20, 64, 128, 200, 254 and 255
+	inputs := []int{0, 1, 10, 20, 64, 128, 200, 254, 255}
+	tests := []struct {
+		name  string
+		gamma *Gamma
+		want  []uint16
+	}{
+		{"power 2.2", power, []uint16{0, 0, 53, 242, 3131, 14386, 38402, 64971, 0xffff}},
+		// Linear below 0.04045, then a power of 2.4
+		{"sRGB", NewGammaSRGB(), []uint16{0, 20, 199, 458, 3360, 14146, 37852, 64952, 0xffff}},
+		// Linear below a lightness of 8, then a cube
+		{"CIE", NewGammaCIE(), []uint16{0, 28, 285, 569, 2914, 12179, 35355, 64873, 0xffff}},
+		{"power 1", linear, []uint16{0, 0x101, 0xa0a, 0x1414, 0x4040, 0x8080, 0xc8c8, 0xfefe, 0xffff}},
+		{"table", inverted, []uint16{0xffff, 0xfefe, 0xf5f5, 0xebeb, 0xbfbf, 0x7f7f, 0x3737, 0x101, 0}},
+	}
+
+	for _, test := range tests {
+		for i, v := range inputs {
+			if got := test.gamma.table[v]; got != test.want[i] {
+				t.Errorf("%v: %v is %#04x, want %#04x", test.name, v, got, test.want[i])
+			}
+			if got, want := test.gamma.Correct(byte(v)), byte((uint32(test.want[i])+0x80)/0x101); got != want {
+				t.Errorf("%v: Correct(%v) is %v, want %v", test.name, v, got, want)
+			}
+			// The entries of the table are where the 16-bit inputs land exactly
+			if got := gamma_correct16(test.gamma, uint32(v)*0x101); got != uint32(test.want[i]) {
+				t.Errorf("%v: 16-bit %#04x is %#04x, want %#04x", test.name, v*0x101, got, test.want[i])
+			}
+		}
+	}
+}
+
+func TestGammaInvalid(t *testing.T) {
+	for _, exponent := range []float64{0, -2.2, math.NaN(), math.Inf(1)} {
+		if gamma, err := NewGammaPower(exponent); !errors.Is(err, ErrGeneric) || gamma != nil {
+			t.Errorf("NewGammaPower(%v): %v, %v, want ErrGeneric", exponent, gamma, err)
+		}
+	}
+	for _, size := range []int{0, 255, 257} {
+		if gamma, err := NewGammaTable(make([]byte, size)); !errors.Is(err, ErrGeneric) || gamma != nil {
+			t.Errorf("NewGammaTable of %v entries: %v, %v, want ErrGeneric", size, gamma, err)
+		}
+	}
+}
+
+func TestSetComponentGamma(t *testing.T) {
+	channel, err := NewLEDStrandChannel(18, 4, 255, false, SK6812_STRIP_RGBW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srgb := NewGammaSRGB()
+
+	for _, component := range []Component{-1, LED_COLOURS} {
+		if err := channel.SetComponentGamma(component, srgb); !errors.Is(err, ErrGeneric) {
+			t.Errorf("SetComponentGamma(%v): %v, want ErrGeneric", component, err)
+		}
+		if gamma := channel.Gamma(component); gamma != nil {
+			t.Errorf("Gamma(%v) is %p, want nil", component, gamma)
+		}
+	}
+
+	if err := channel.SetComponentGamma(ComponentGreen, srgb); err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range []Component{ComponentRed, ComponentGreen, ComponentBlue, ComponentWhite} {
+		want := (*Gamma)(nil)
+		if component == ComponentGreen {
+			want = srgb
+		}
+		if gamma := channel.Gamma(component); gamma != want {
+			t.Errorf("Gamma(%v) is %p, want %p", component, gamma, want)
+		}
+	}
+
+	// nil removes the correction
+	if err := channel.SetComponentGamma(ComponentGreen, nil); err != nil {
+		t.Fatal(err)
+	}
+	if gamma := channel.Gamma(ComponentGreen); gamma != nil {
+		t.Errorf("Gamma(green) is %p after removing it, want nil", gamma)
+	}
+}
+
+func TestGammaRender(t *testing.T) {
+	strand, _, vc := fake_strand(t, 18, false)
+	defer vc.Check(t)
+	defer strand.Close()
+
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	power, err := NewGammaPower(2.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The curves follow the components, whatever order the GRB strip sends them in
+	channel.SetComponentGamma(ComponentRed, NewGammaSRGB())
+	channel.SetComponentGamma(ComponentGreen, power)
+	channel.SetComponentGamma(ComponentBlue, NewGammaCIE())
+
+	render := func() []uint32 {
+		t.Helper()
+		if err := strand.Render(); err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		leds, err := strand.Waveform().Decode(strand.Raw())
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return leds[0]
+	}
+
+	if err := channel.CopyFrom([]uint32{0x00804080, 0x00ffffff, 0x00000000, 0x000a14c8}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint32{0x00370c2f, 0x00ffffff, 0x00000000, 0x0001018a} {
+		if got := render()[i]; got != want {
+			t.Errorf("LED %v is %08x, want %08x", i, got, want)
+		}
+	}
+
+	// 16-bit colors are interpolated between the entries, from 0 to 0xffff.
+	// Without a frame rate nothing is dithered: the outputs are rounded.
+	channel.SetDither(true)
+	colors := []Color64{
+		RGBW64(0x8000, 0x8000, 0x8000, 0),
+		RGBW64(0xffff, 0xffff, 0xffff, 0),
+		RGBW64(0, 0, 0, 0),
+		RGBW64(0xc000, 0x2000, 0xc000, 0),
+	}
+	for i, color := range colors {
+		if err := channel.SetPixel64(i, color); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leds := render()
+	for i, want := range []uint32{0x0037382f, 0x00ffffff, 0x00000000, 0x0085037b} {
+		if leds[i] != want {
+			t.Errorf("16-bit LED %v is %08x, want %08x", i, leds[i], want)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package rpiws2811
 
+import "unsafe"
+
 // **** <gpio.h> ****
 
 type gpio_t struct {
@@ -31,12 +33,20 @@ type gpio_t struct {
 	test       uint32
 } // TODO @jmbarzee __attribute__((packed, aligned(4))) gpio_t;
 
+// Register offsets in gpio_t, the banks of fsel, set and clr are 4 bytes apart
+const (
+	GPIO_FSEL = unsafe.Offsetof(gpio_t{}.fsel)
+	GPIO_SET  = unsafe.Offsetof(gpio_t{}.set)
+	GPIO_CLR  = unsafe.Offsetof(gpio_t{}.clr)
+	GPIO_LEV  = unsafe.Offsetof(gpio_t{}.lev)
+)
+
 const (
 	GPIO_OFFSET = 0x00200000
 )
 
-func gpio_function_set(gpio *gpio_t, pin int, function int) {
-	regnum := uint32(pin / 10)
+func gpio_function_set(gpio Registers, pin int, function int) {
+	regnum := uintptr(pin / 10)
 	offset := uint32((pin % 10) * 3)
 	funcmap := []uint32{4, 5, 6, 7, 3, 2} // See datasheet for mapping
 
@@ -44,31 +54,35 @@ func gpio_function_set(gpio *gpio_t, pin int, function int) {
 		return
 	}
 
-	gpio.fsel[regnum] &= ^(0x7 << offset)
-	gpio.fsel[regnum] |= uint32((funcmap[function]) << offset)
+	fsel := gpio.Read32(GPIO_FSEL + regnum*4)
+	fsel &= ^(0x7 << offset)
+	fsel |= uint32((funcmap[function]) << offset)
+	gpio.Write32(GPIO_FSEL+regnum*4, fsel)
 }
 
-func gpio_level_set(gpio *gpio_t, pin uint8, level uint8) {
-	regnum := uint32(pin >> 5)
+func gpio_level_set(gpio Registers, pin uint8, level uint8) {
+	regnum := uintptr(pin >> 5)
 	offset := uint32(pin & 0x1f)
 
 	if level != 0 {
-		gpio.set[regnum] = (1 << offset)
+		gpio.Write32(GPIO_SET+regnum*4, 1<<offset)
 	} else {
-		gpio.clr[regnum] = (1 << offset)
+		gpio.Write32(GPIO_CLR+regnum*4, 1<<offset)
 	}
 }
 
-func gpio_output_set(gpio *gpio_t, pin uint8, output uint8) {
-	regnum := uint32(pin / 10)
+func gpio_output_set(gpio Registers, pin uint8, output uint8) {
+	regnum := uintptr(pin / 10)
 	offset := uint32((pin % 10) * 3)
 	function := uint8(0)
 	if output != 0 {
 		function = 1 // See datasheet for mapping
 	}
 
-	gpio.fsel[regnum] &= ^(0x7 << offset)
-	gpio.fsel[regnum] |= uint32((function & 0x7) << offset)
+	fsel := gpio.Read32(GPIO_FSEL + regnum*4)
+	fsel &= ^(0x7 << offset)
+	fsel |= uint32((function & 0x7) << offset)
+	gpio.Write32(GPIO_FSEL+regnum*4, fsel)
 }
 
 // **** </gpio.h> ****
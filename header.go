@@ -0,0 +1,404 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Functions of the pins which can drive LEDs
+const (
+	PIN_FUNC_PWM0     = "PWM0"     // PWM channel 0, drives LED channel 0
+	PIN_FUNC_PWM1     = "PWM1"     // PWM channel 1, drives LED channel 1
+	PIN_FUNC_PCM_DOUT = "PCM_DOUT" // Drives LED channel 0 alone
+)
+
+// Names of the PCM functions, by PCMFUN_xxx
+var pcm_function_names = [NUM_PCMFUNS]string{"PCM_CLK", "PCM_FS", "PCM_DIN", PIN_FUNC_PCM_DOUT}
+
+// rpi_header_t is a header of a board, mapping its pins to the GPIOs they are
+// wired to.
+type rpi_header_t struct {
+	name  string         // As printed on the board, e.g. J8
+	desc  string         // e.g. 40-pin header
+	gpios map[int]int    // GPIO by header pin
+	other map[int]string // What the pins which aren't GPIOs are
+}
+
+// rpi_board_t is the layout of the GPIOs broken out by a family of boards.
+type rpi_board_t struct {
+	headers []*rpi_header_t // The main header first
+	gpios   []int           // GPIOs broken out without a header, e.g. on the edge connector of a Compute Module
+}
+
+// pin_function_t is an alternate function of a GPIO.
+type pin_function_t struct {
+	name   string // PIN_FUNC_xxx, a PCM function or SPIn_MOSI
+	altnum int
+}
+
+var header_26pin_power = map[int]string{1: "3V3", 2: "5V", 4: "5V", 6: "GND", 9: "GND", 14: "GND", 17: "3V3", 20: "GND", 25: "GND"}
+
+// P1 of the Model B Rev 1, whose pins 4, 9, 14, 17, 20 and 25 are reserved
+var header_26pin_rev1 = rpi_header_t{
+	name: "P1",
+	desc: "26-pin header",
+	gpios: map[int]int{
+		3: 0, 5: 1, 7: 4, 8: 14, 10: 15, 11: 17, 12: 18, 13: 21, 15: 22, 16: 23,
+		18: 24, 19: 10, 21: 9, 22: 25, 23: 11, 24: 8, 26: 7,
+	},
+	other: map[int]string{1: "3V3", 2: "5V", 4: "DNC", 6: "GND", 9: "DNC", 14: "DNC", 17: "DNC", 20: "DNC", 25: "DNC"},
+}
+
+// P1 of the Model B Rev 2 and the Model A
+var header_26pin_rev2 = rpi_header_t{
+	name: "P1",
+	desc: "26-pin header",
+	gpios: map[int]int{
+		3: 2, 5: 3, 7: 4, 8: 14, 10: 15, 11: 17, 12: 18, 13: 27, 15: 22, 16: 23,
+		18: 24, 19: 10, 21: 9, 22: 25, 23: 11, 24: 8, 26: 7,
+	},
+	other: header_26pin_power,
+}
+
+// P5 of the Model B Rev 2 and the Model A, an unpopulated 8-pin header
+var header_p5 = rpi_header_t{
+	name: "P5",
+	desc: "P5 header",
+	gpios: map[int]int{
+		3: 28, 4: 29, 5: 30, 6: 31,
+	},
+	other: map[int]string{1: "5V", 2: "3V3", 7: "GND", 8: "GND"},
+}
+
+// J8 of every board since the B+, P1 on the first ones
+var header_40pin = rpi_header_t{
+	name: "J8",
+	desc: "40-pin header",
+	gpios: map[int]int{
+		3: 2, 5: 3, 7: 4, 8: 14, 10: 15, 11: 17, 12: 18, 13: 27, 15: 22, 16: 23,
+		18: 24, 19: 10, 21: 9, 22: 25, 23: 11, 24: 8, 26: 7, 27: 0, 28: 1, 29: 5,
+		31: 6, 32: 12, 33: 13, 35: 19, 36: 16, 37: 26, 38: 20, 40: 21,
+	},
+	other: map[int]string{
+		1: "3V3", 2: "5V", 4: "5V", 6: "GND", 9: "GND", 14: "GND", 17: "3V3", 20: "GND",
+		25: "GND", 30: "GND", 34: "GND", 39: "GND",
+	},
+}
+
+var (
+	rpi_board_26pin_rev1 = rpi_board_t{headers: []*rpi_header_t{&header_26pin_rev1}}
+	rpi_board_26pin_rev2 = rpi_board_t{headers: []*rpi_header_t{&header_26pin_rev2, &header_p5}}
+	rpi_board_40pin      = rpi_board_t{headers: []*rpi_header_t{&header_40pin}}
+
+	// Compute Modules 1, 3 and 3+ and 4S, on a SODIMM edge connector
+	rpi_board_cm_sodimm = rpi_board_t{gpios: gpio_range(0, 45)}
+	// Compute Module 4, on two high density connectors
+	rpi_board_cm4 = rpi_board_t{gpios: gpio_range(0, 27)}
+)
+
+func gpio_range(first, last int) []int {
+	gpios := make([]int, 0, last-first+1)
+	for gpio := first; gpio <= last; gpio++ {
+		gpios = append(gpios, gpio)
+	}
+	return gpios
+}
+
+/**
+ * Find the layout of the GPIOs broken out by a board.
+ *
+ * @param    rpi_hw  board.
+ *
+ * @returns  the layout, the 40-pin header when the board isn't known otherwise
+ */
+func rpi_board_of(rpi_hw *rpi_hw_t) *rpi_board_t {
+	hwver := rpi_hw.hwver
+	switch {
+	case hwver == 0: // Only known from its device tree
+	case (hwver & RPI_REV_NEW_FLAG) == 0:
+		switch hwver &^ (RPI_WARRANTY_MASK | RPI_MANUFACTURER_MASK) {
+		case 0x02, 0x03:
+			return &rpi_board_26pin_rev1
+		case 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0d, 0x0e, 0x0f:
+			return &rpi_board_26pin_rev2
+		case 0x11, 0x14:
+			return &rpi_board_cm_sodimm
+		}
+	default:
+		switch (hwver >> RPI_REV_TYPE_SHIFT) & 0xff {
+		case 0x00, 0x01: // Model A and B
+			return &rpi_board_26pin_rev2
+		case 0x06, 0x0a, 0x10, 0x15: // Compute Modules 1, 3, 3+ and 4S
+			return &rpi_board_cm_sodimm
+		case 0x14: // Compute Module 4
+			return &rpi_board_cm4
+		}
+	}
+	return &rpi_board_40pin
+}
+
+/**
+ * Find where a GPIO is broken out on a board.
+ *
+ * @param    board    layout of the board.
+ * @param    gpionum  gpio.
+ *
+ * @returns  the header and its pin, nil if the GPIO is broken out without a
+ *           header; ok false if it isn't broken out
+ */
+func (board *rpi_board_t) find(gpionum int) (*rpi_header_t, int, bool) {
+	for _, header := range board.headers {
+		for pin, gpio := range header.gpios {
+			if gpio == gpionum {
+				return header, pin, true
+			}
+		}
+	}
+	for _, gpio := range board.gpios {
+		if gpio == gpionum {
+			return nil, 0, true
+		}
+	}
+	return nil, 0, false
+}
+
+// describe names a GPIO with where it is broken out and what else is told
+// about it, e.g. "GPIO 18 (J8 pin 12, PWM0)".
+func (board *rpi_board_t) describe(gpionum int, about ...string) string {
+	if header, pin, ok := board.find(gpionum); ok && header != nil {
+		about = append([]string{fmt.Sprintf("%v pin %v", header.name, pin)}, about...)
+	}
+	if len(about) == 0 {
+		return fmt.Sprintf("GPIO %v", gpionum)
+	}
+	return fmt.Sprintf("GPIO %v (%v)", gpionum, strings.Join(about, ", "))
+}
+
+// broken_out returns the GPIOs broken out, by header and pin, then by number.
+func (board *rpi_board_t) broken_out() []int {
+	var gpios []int
+	for _, header := range board.headers {
+		pins := make([]int, 0, len(header.gpios))
+		for pin := range header.gpios {
+			pins = append(pins, pin)
+		}
+		sort.Ints(pins)
+		for _, pin := range pins {
+			gpios = append(gpios, header.gpios[pin])
+		}
+	}
+	return append(gpios, board.gpios...)
+}
+
+/**
+ * List the alternate functions of a GPIO which can drive LEDs or belong to
+ * the PCM, on the SoC of a board.
+ *
+ * @param    rpi_hw   board.
+ * @param    gpionum  gpio.
+ *
+ * @returns  the functions, none if the GPIO has none of them
+ */
+func gpio_functions(rpi_hw *rpi_hw_t, gpionum int) []pin_function_t {
+	var functions []pin_function_t
+
+	for channel, name := range []string{PIN_FUNC_PWM0, PIN_FUNC_PWM1} {
+		// GPIO 40 and 41 of the BCM2711 are the outputs of its second PWM, which isn't driven
+		if rpi_hw.soc == RPI_SOC_BCM2711 && (gpionum == 40 || gpionum == 41) {
+			break
+		}
+		if altnum, err := pwm_pin_alt(channel, gpionum); err == nil {
+			functions = append(functions, pin_function_t{name: name, altnum: altnum})
+		}
+	}
+	for pcmfun, name := range pcm_function_names {
+		if altnum, err := pcm_pin_alt(pcmfun, gpionum); err == nil {
+			functions = append(functions, pin_function_t{name: name, altnum: altnum})
+		}
+	}
+	if pin, ok := spi_pin(rpi_hw, gpionum); ok {
+		functions = append(functions, pin_function_t{name: pin.name, altnum: pin.altnum})
+	}
+
+	return functions
+}
+
+/**
+ * Find the function among some which a GPIO of a board has.
+ *
+ * @param    rpi_hw   board.
+ * @param    gpionum  gpio.
+ * @param    allowed  accepts the names of the wanted functions.
+ *
+ * @returns  the function, ok false if the GPIO has none of them
+ */
+func gpio_function(rpi_hw *rpi_hw_t, gpionum int, allowed func(name string) bool) (pin_function_t, bool) {
+	for _, function := range gpio_functions(rpi_hw, gpionum) {
+		if allowed(function.name) {
+			return function, true
+		}
+	}
+	return pin_function_t{}, false
+}
+
+// Functions which drive LED channel 0, or channel 1 alone
+func channel0_function(name string) bool {
+	return name == PIN_FUNC_PWM0 || name == PIN_FUNC_PCM_DOUT || strings.HasSuffix(name, "_MOSI")
+}
+
+func channel1_function(name string) bool {
+	return name == PIN_FUNC_PWM1
+}
+
+/**
+ * Check a GPIO of a board can drive an LED channel, explaining why not and
+ * which GPIOs can otherwise.
+ *
+ * @param    rpi_hw   board.
+ * @param    channum  LED channel.
+ * @param    gpionum  gpio.
+ * @param    allowed  accepts the names of the functions which can drive it.
+ * @param    what     the functions, for the error.
+ *
+ * @returns  the function of the GPIO, error if it can't drive the channel
+ */
+func board_check_gpio(rpi_hw *rpi_hw_t, channum int, gpionum int, allowed func(name string) bool, what string) (pin_function_t, error) {
+	board := rpi_board_of(rpi_hw)
+
+	if _, _, ok := board.find(gpionum); ok {
+		if function, ok := gpio_function(rpi_hw, gpionum, allowed); ok {
+			return function, nil
+		}
+	}
+
+	var usable []string
+	for _, gpio := range board.broken_out() {
+		if function, ok := gpio_function(rpi_hw, gpio, allowed); ok {
+			usable = append(usable, board.describe(gpio, function.name))
+		}
+	}
+
+	reason := fmt.Sprintf("isn't broken out on %v", rpi_hw.desc)
+	if _, _, ok := board.find(gpionum); ok {
+		var names []string
+		for _, function := range gpio_functions(rpi_hw, gpionum) {
+			names = append(names, function.name)
+		}
+		reason = fmt.Sprintf("has no %v function", what)
+		if len(names) > 0 {
+			reason = fmt.Sprintf("is %v, not %v", strings.Join(names, " or "), what)
+		}
+	}
+	if len(usable) == 0 {
+		return pin_function_t{}, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "board_check_gpio", "%v %v, and %v has no %v pin for LED channel %v", board.describe(gpionum), reason, rpi_hw.desc, what, channum)
+	}
+	return pin_function_t{}, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "board_check_gpio", "%v %v, LED channel %v can use %v", board.describe(gpionum), reason, channum, strings.Join(usable, ", "))
+}
+
+// pin_spec is a pin given to SetPin, before it is resolved to a GPIO.
+type pin_spec struct {
+	text     string
+	gpionum  int    // GPIO number, -1 for a header pin or a function
+	header   string // Header of a header pin, "" for the main one
+	pin      int    // Header pin, 0 for a GPIO or a function
+	function string // PIN_FUNC_xxx or SPIn_MOSI, "" for a GPIO or a header pin
+}
+
+var (
+	pin_spec_gpio     = regexp.MustCompile(`^(?:gpio|bcm)?\s*(\d+)$`)
+	pin_spec_header   = regexp.MustCompile(`^(?:(p1|j8|p5)\s*-?\s*)?(?:pin\s*)?(\d+)$`)
+	pin_spec_function = map[string]string{
+		"pwm0":     PIN_FUNC_PWM0,
+		"pwm1":     PIN_FUNC_PWM1,
+		"pcm":      PIN_FUNC_PCM_DOUT,
+		"pcm_dout": PIN_FUNC_PCM_DOUT,
+		"spi":      "SPI0_MOSI",
+	}
+)
+
+/**
+ * Parse a pin given as a GPIO ("18", "GPIO18"), a header pin ("pin 12",
+ * "P5 pin 6", "J8-12") or a function ("PWM0", "PWM1", "PCM", "SPI", "SPI3").
+ *
+ * @param    text  the pin.
+ *
+ * @returns  the pin, error if it isn't any of those
+ */
+func parse_pin_spec(text string) (*pin_spec, error) {
+	s := strings.ToLower(strings.TrimSpace(text))
+	spec := &pin_spec{text: text, gpionum: -1}
+
+	if all := pin_spec_gpio.FindStringSubmatch(s); all != nil {
+		spec.gpionum, _ = strconv.Atoi(all[1])
+		return spec, nil
+	}
+	if all := pin_spec_header.FindStringSubmatch(s); all != nil {
+		spec.header = strings.ToUpper(all[1])
+		spec.pin, _ = strconv.Atoi(all[2])
+		return spec, nil
+	}
+
+	s = strings.TrimSuffix(strings.ReplaceAll(s, " ", "_"), "_mosi")
+	if function, ok := pin_spec_function[s]; ok {
+		spec.function = function
+		return spec, nil
+	}
+	if len(s) == 4 && strings.HasPrefix(s, "spi") && s[3] >= '0' && s[3] <= '6' {
+		spec.function = strings.ToUpper(s) + "_MOSI"
+		return spec, nil
+	}
+
+	return nil, fmt.Errorf("invalid pin %q, give a GPIO like GPIO18, a header pin like \"pin 12\" or a function like PWM0", text)
+}
+
+/**
+ * Resolve a pin to the GPIO it is on a board.
+ *
+ * @param    rpi_hw  board.
+ * @param    spec    the pin.
+ *
+ * @returns  the gpio, error if the board has no such pin
+ */
+func resolve_pin(rpi_hw *rpi_hw_t, spec *pin_spec) (int, error) {
+	board := rpi_board_of(rpi_hw)
+
+	switch {
+	case spec.gpionum >= 0:
+		return spec.gpionum, nil
+
+	case spec.pin > 0:
+		if len(board.headers) == 0 {
+			return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "resolve_pin", "%v has no header for %q, give a GPIO", rpi_hw.desc, spec.text)
+		}
+		header := board.headers[0]
+		if spec.header != "" && spec.header != header.name && !(spec.header == "P1" && header.name == "J8") {
+			header = nil
+			for _, h := range board.headers {
+				if h.name == spec.header {
+					header = h
+				}
+			}
+			if header == nil {
+				return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "resolve_pin", "%v has no %v header for %q", rpi_hw.desc, spec.header, spec.text)
+			}
+		}
+		if gpio, ok := header.gpios[spec.pin]; ok {
+			return gpio, nil
+		}
+		if what, ok := header.other[spec.pin]; ok {
+			return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "resolve_pin", "pin %v of the %v of %v is %v, not a GPIO", spec.pin, header.desc, rpi_hw.desc, what)
+		}
+		return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "resolve_pin", "the %v of %v has no pin %v", header.desc, rpi_hw.desc, spec.pin)
+
+	default:
+		for _, gpio := range board.broken_out() {
+			if _, ok := gpio_function(rpi_hw, gpio, func(name string) bool { return name == spec.function }); ok {
+				return gpio, nil
+			}
+		}
+		return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "resolve_pin", "%v has no GPIO broken out with %v", rpi_hw.desc, spec.function)
+	}
+}
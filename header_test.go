@@ -0,0 +1,169 @@
+package rpiws2811
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Detect a board from a cpuinfo of testdata.
+ *
+ * @param    t        test.
+ * @param    cpuinfo  name of the cpuinfo.
+ *
+ * @returns  the board
+ */
+func test_board(t *testing.T, cpuinfo string) *rpi_hw_t {
+	t.Helper()
+
+	rpi_hw, err := rpi_hw_detect(filepath.Join("testdata", "cpuinfo", cpuinfo))
+	if err != nil {
+		t.Fatalf("%v: %v", cpuinfo, err)
+	}
+	return rpi_hw
+}
+
+func TestParsePinSpec(t *testing.T) {
+	tests := []struct {
+		text string
+		want pin_spec // text is left out, an empty pin_spec for an error
+	}{
+		{"18", pin_spec{gpionum: 18}},
+		{"GPIO18", pin_spec{gpionum: 18}},
+		{" bcm 12 ", pin_spec{gpionum: 12}},
+		{"pin 12", pin_spec{gpionum: -1, pin: 12}},
+		{"P5-6", pin_spec{gpionum: -1, header: "P5", pin: 6}},
+		{"J8 pin 12", pin_spec{gpionum: -1, header: "J8", pin: 12}},
+		{"p1-13", pin_spec{gpionum: -1, header: "P1", pin: 13}},
+		{"PWM0", pin_spec{gpionum: -1, function: PIN_FUNC_PWM0}},
+		{"PWM1", pin_spec{gpionum: -1, function: PIN_FUNC_PWM1}},
+		{"PCM", pin_spec{gpionum: -1, function: PIN_FUNC_PCM_DOUT}},
+		{"pcm dout", pin_spec{gpionum: -1, function: PIN_FUNC_PCM_DOUT}},
+		{"SPI", pin_spec{gpionum: -1, function: "SPI0_MOSI"}},
+		{"SPI3", pin_spec{gpionum: -1, function: "SPI3_MOSI"}},
+		{"spi6 mosi", pin_spec{gpionum: -1, function: "SPI6_MOSI"}},
+		{"SPI7", pin_spec{}},
+		{"PWM2", pin_spec{}},
+		{"GPIO-1", pin_spec{}},
+		{"P2-6", pin_spec{}},
+		{"LED", pin_spec{}},
+		{"", pin_spec{}},
+	}
+
+	for _, test := range tests {
+		spec, err := parse_pin_spec(test.text)
+		if test.want == (pin_spec{}) {
+			if err == nil {
+				t.Errorf("%q: parsed as %+v", test.text, *spec)
+			} else if !strings.Contains(err.Error(), "GPIO18") || !strings.Contains(err.Error(), "PWM0") {
+				t.Errorf("%q: error %q doesn't tell how to give a pin", test.text, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		test.want.text = test.text
+		if *spec != test.want {
+			t.Errorf("%q: %+v, want %+v", test.text, *spec, test.want)
+		}
+	}
+}
+
+func TestResolvePin(t *testing.T) {
+	tests := []struct {
+		cpuinfo string
+		text    string
+		gpionum int
+		err     string // Part of the error, "" for none
+	}{
+		{"pi3b", "pin 12", 18, ""},
+		{"pi3b", "J8-33", 13, ""},
+		// The 40-pin header was P1 on the first boards which had it
+		{"pi3b", "P1 pin 40", 21, ""},
+		{"pi3b", "PWM1", 13, ""},
+		{"pi3b", "SPI", 10, ""},
+		{"pi3b", "GPIO 45", 45, ""},
+		{"pi3b", "pin 6", 0, "pin 6 of the 40-pin header of Pi 3 Model B Rev 1.2, 1GB, Sony UK is GND, not a GPIO"},
+		{"pi3b", "pin 41", 0, "the 40-pin header of Pi 3 Model B Rev 1.2, 1GB, Sony UK has no pin 41"},
+		{"pi3b", "P5-6", 0, `has no P5 header for "P5-6"`},
+		{"pi3b", "SPI3", 0, "has no GPIO broken out with SPI3_MOSI"},
+		{"pi4b", "SPI3", 2, ""},
+		{"pi1b", "P5-6", 31, ""},
+		{"pi1b", "pin 13", 27, ""},
+		{"pi1b", "PWM1", 0, "Model B has no GPIO broken out with PWM1"},
+		{"pi1b-rev1", "pin 13", 21, ""},
+		{"pi1b-rev1", "P5-6", 0, `Model B has no P5 header for "P5-6"`},
+		{"pi1b-rev1", "pin 9", 0, "pin 9 of the 26-pin header of Model B is DNC, not a GPIO"},
+		{"cm4", "PWM1", 13, ""},
+		{"cm4", "pin 12", 0, `has no header for "pin 12", give a GPIO`},
+	}
+
+	for _, test := range tests {
+		name := test.cpuinfo + "/" + test.text
+		spec, err := parse_pin_spec(test.text)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		gpionum, err := resolve_pin(test_board(t, test.cpuinfo), spec)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%v: %v", name, err)
+		case test.err == "" && gpionum != test.gpionum:
+			t.Errorf("%v: GPIO %v, want %v", name, gpionum, test.gpionum)
+		case test.err != "" && (!errors.Is(err, ErrIllegalGPIO) || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%v: error %v, want ErrIllegalGPIO with %q", name, err, test.err)
+		}
+	}
+}
+
+func TestBoardCheckGPIO(t *testing.T) {
+	tests := []struct {
+		cpuinfo  string
+		channum  int
+		gpionum  int
+		function string // Function found, "" for an error
+		err      string // Part of the error
+	}{
+		{"pi3b", 0, 18, PIN_FUNC_PWM0, ""},
+		{"pi3b", 0, 21, PIN_FUNC_PCM_DOUT, ""},
+		{"pi3b", 0, 10, "SPI0_MOSI", ""},
+		{"pi3b", 1, 13, PIN_FUNC_PWM1, ""},
+		{"pi3b", 0, 13, "", "GPIO 13 (J8 pin 33) is PWM1, not PWM0, PCM_DOUT or SPI MOSI, LED channel 0 can use " +
+			"GPIO 18 (J8 pin 12, PWM0), GPIO 10 (J8 pin 19, SPI0_MOSI), GPIO 12 (J8 pin 32, PWM0), GPIO 21 (J8 pin 40, PCM_DOUT)"},
+		{"pi3b", 1, 18, "", "GPIO 18 (J8 pin 12) is PWM0 or PCM_CLK, not PWM1, LED channel 1 can use GPIO 13 (J8 pin 33, PWM1), GPIO 19 (J8 pin 35, PWM1)"},
+		{"pi3b", 0, 4, "", "GPIO 4 (J8 pin 7) has no PWM0, PCM_DOUT or SPI MOSI function"},
+		// GPIO 12 is on pin 32 of the 40-pin header only
+		{"pi1b-rev1", 0, 12, "", "GPIO 12 isn't broken out on Model B, LED channel 0 can use " +
+			"GPIO 18 (P1 pin 12, PWM0), GPIO 21 (P1 pin 13, PCM_DOUT), GPIO 10 (P1 pin 19, SPI0_MOSI)"},
+		{"pi1b-rev1", 1, 12, "", "GPIO 12 isn't broken out on Model B, and Model B has no PWM1 pin for LED channel 1"},
+		// The PCM_DOUT of the Model B rev 2 is on P5
+		{"pi1b", 0, 31, PIN_FUNC_PCM_DOUT, ""},
+		{"cm4", 0, 12, PIN_FUNC_PWM0, ""},
+		{"cm4", 1, 18, "", "GPIO 18 is PWM0 or PCM_CLK, not PWM1, LED channel 1 can use GPIO 13 (PWM1), GPIO 19 (PWM1)"},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%v channel %v GPIO %v", test.cpuinfo, test.channum, test.gpionum)
+		allowed, what := channel0_function, "PWM0, PCM_DOUT or SPI MOSI"
+		if test.channum == 1 {
+			allowed, what = channel1_function, PIN_FUNC_PWM1
+		}
+
+		function, err := board_check_gpio(test_board(t, test.cpuinfo), test.channum, test.gpionum, allowed, what)
+		if test.function != "" {
+			if err != nil || function.name != test.function {
+				t.Errorf("%v: %v, %v, want %v", name, function.name, err, test.function)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrIllegalGPIO) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%v: error %v, want ErrIllegalGPIO with %q", name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package rpiws2811
+
+// Layout places the LEDs of a channel on a grid, to display them the way they
+// are mounted.
+type Layout struct {
+	Width      int  // LEDs per row, 0 for a single strip
+	Serpentine bool // Every other row runs backwards, like on the Pimoroni Unicorn HAT
+}
+
+// Size returns the number of columns and rows of the grid holding count LEDs.
+func (layout Layout) Size(count int) (width, height int) {
+	if layout.Width <= 0 {
+		return count, 1
+	}
+	return layout.Width, (count + layout.Width - 1) / layout.Width
+}
+
+// Position returns the column and row of LED i.
+func (layout Layout) Position(i int) (x, y int) {
+	if layout.Width <= 0 {
+		return i, 0
+	}
+
+	x, y = i%layout.Width, i/layout.Width
+	if layout.Serpentine && y%2 == 1 {
+		x = layout.Width - 1 - x
+	}
+	return x, y
+}
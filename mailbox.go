@@ -2,9 +2,7 @@ package rpiws2811
 
 import (
 	"fmt"
-	"log"
 	"os"
-	"reflect"
 	"syscall"
 	"unsafe"
 )
@@ -28,6 +26,21 @@ const (
 	IOC_IN    = uint32(0x80000000)
 	IOC_INOUT = (IOC_IN | IOC_OUT)
 	// #include </linux/ioccom.h>
+
+	// Codes of the property messages
+	MBOX_REQUEST          = 0x00000000
+	MBOX_RESPONSE_SUCCESS = 0x80000000
+	MBOX_RESPONSE_ERROR   = 0x80000001
+	MBOX_TAG_RESPONSE     = 0x80000000 // Set in the data size of the tags answered
+
+	// Tags of the property messages
+	MBOX_TAG_ALLOCATE_MEMORY = 0x3000c
+	MBOX_TAG_LOCK_MEMORY     = 0x3000d
+	MBOX_TAG_UNLOCK_MEMORY   = 0x3000e
+	MBOX_TAG_RELEASE_MEMORY  = 0x3000f
+	MBOX_TAG_EXECUTE_CODE    = 0x30010
+	MBOX_TAG_EXECUTE_QPU     = 0x30011
+	MBOX_TAG_ENABLE_QPU      = 0x30012
 )
 
 var ( // TODO @jmbarzee const
@@ -47,76 +60,81 @@ func _IOC(inout uint32, group uint32, num uint32, len uint32) uint32 {
 // **** </mailbox.h> ****
 // **** <mailbox.c> ****
 
-func mapmem(base uint32, memLength uintptr, mem_dev string) unsafe.Pointer {
+/**
+ * Map physical memory of a memory device.
+ *
+ * @param    base       physical address, which needn't be page aligned.
+ * @param    memLength  number of bytes past base.
+ * @param    mem_dev    memory device, normally /dev/mem.
+ *
+ * @returns  a pointer to base and the whole mapping, from the page boundary,
+ *           to release with unmapmem
+ */
+func mapmem(base uint32, memLength uintptr, mem_dev string) (unsafe.Pointer, []byte, error) {
 	offsetmask := uint32(os.Getpagesize() - 1)
 	pagemask := ^uint32(0) ^ offsetmask
-	var mem_fd uintptr
 
 	file, err := os.OpenFile(mem_dev, os.O_RDWR|os.O_SYNC, 0)
-	defer file.Close()
 	if err != nil {
-		log.Printf("Can't open %v", mem_dev)
-		return nil
+		return nil, nil, ws2811_error(WS2811_ERROR_MMAP, "mapmem", err)
 	}
-	mem_fd = file.Fd()
+	defer file.Close()
 
-	bytes, err := syscall.Mmap(
-		int(mem_fd),
+	// map from the page boundary, covering the requested length past the offset
+	offset := uintptr((base & offsetmask))
+	mapping, err := syscall.Mmap(
+		int(file.Fd()),
 		int64(base&pagemask),
-		int(memLength),
+		int(memLength+offset),
 		syscall.PROT_READ|syscall.PROT_WRITE,
 		syscall.MAP_SHARED,
 	)
 	if err != nil {
-		log.Printf("mmap error %v", err)
-		return nil
+		return nil, nil, ws2811_error(WS2811_ERROR_MMAP, "mapmem", fmt.Errorf("mmap %v at %#x: %w", mem_dev, base, err))
 	}
 
 	// return a pointer to the new memory at an offset of (base & offsetmask) * sizeof byte
-	offset := uintptr((base & offsetmask))
-	return unsafe.Pointer(uintptr(unsafe.Pointer(&bytes[0])) + offset)
+	return unsafe.Pointer(&mapping[offset]), mapping, nil
 }
 
-func unmapmem(addr unsafe.Pointer, size uintptr) {
-	offsetmask := uint32(os.Getpagesize() - 1)
-	pagemask := ^uint32(0) ^ offsetmask
-	baseaddr := uintptr(uint32(uintptr(addr)) & pagemask)
-
-	sh := &reflect.SliceHeader{
-		Data: baseaddr,
-		Len:  int(size),
-		Cap:  int(size),
-	}
-	mem := *(*[]byte)(unsafe.Pointer(sh))
-
-	err := syscall.Munmap(mem)
-	if err != nil {
-		log.Printf("mmap error %v", err)
+/**
+ * Release memory mapped by mapmem.
+ *
+ * @param    mapping  the whole mapping returned by mapmem.
+ *
+ * @returns  nil on success, error otherwise
+ */
+func unmapmem(mapping []byte) error {
+	if err := syscall.Munmap(mapping); err != nil {
+		return ws2811_error(WS2811_ERROR_MMAP, "unmapmem", err)
 	}
+	return nil
 }
 
 /*
- * use ioctl to send mbox property message
+ * send mbox property message, through a temporary mailbox if mbox is nil
  */
 // TODO @jmbarzee static
-func mbox_property(file *os.File, buf unsafe.Pointer) error {
+func mbox_property(mbox Mailbox, buf []uint32) error {
 
-	if file == nil || file.Fd() < 0 {
-		file, err := mbox_open()
-		defer file.Close()
+	if mbox == nil {
+		tmp, err := VCIO{}.Open()
 		if err != nil {
-			log.Printf("mbox_property open file failed: %v\n", err)
 			return err
 		}
+		defer tmp.Close()
+		mbox = tmp
 	}
-	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, uintptr(file.Fd()), uintptr(IOCTL_MBOX_PROPERTY), uintptr(buf))
-	if err < 0 {
-		return fmt.Errorf("ioctl_set_msg failed: %v\n", err)
+	if err := mbox.Property(buf); err != nil {
+		return ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "mbox_property", err)
+	}
+	if buf[1] != MBOX_RESPONSE_SUCCESS {
+		return ws2811_errorf(WS2811_ERROR_MAILBOX_DEVICE, "mbox_property", "response code %#x", buf[1])
 	}
 	return nil
 }
 
-func mem_alloc(file *os.File, size uint32, align uint32, flags uint32) uint32 {
+func mem_alloc(mbox Mailbox, size uint32, align uint32, flags uint32) (uint32, error) {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -131,14 +149,18 @@ func mem_alloc(file *os.File, size uint32, align uint32, flags uint32) uint32 {
 
 	p[8] = 0x00000000                      // end tag
 	p[0] = 9 * uint32(unsafe.Sizeof(p[0])) // actual size
-	err := mbox_property(file, unsafe.Pointer(&p[0]))
+	// the reply overwrites the request values with the result
+	err := mbox_property(mbox, p)
 	if err != nil {
-		return 0
+		return 0, ws2811_error(WS2811_ERROR_OUT_OF_MEMORY, "mem_alloc", err)
+	}
+	if p[5] == 0 {
+		return 0, ws2811_errorf(WS2811_ERROR_OUT_OF_MEMORY, "mem_alloc", "no handle for %v bytes", size)
 	}
-	return p[5] // TODO @jmbarzee why are these all returning numbers that the caller has? Are they being modified?
+	return p[5], nil
 }
 
-func mem_free(file *os.File, handle uint32) uint32 {
+func mem_free(mbox Mailbox, handle uint32) error {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -152,14 +174,17 @@ func mem_free(file *os.File, handle uint32) uint32 {
 	p[6] = 0x00000000                      // end tag
 	p[0] = 7 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	mbox_property(file, unsafe.Pointer(&p))
-	// TODO @jmbarze error check
-
-	return p[5]
+	err := mbox_property(mbox, p)
+	if err != nil {
+		return err
+	}
+	if p[5] != 0 {
+		return ws2811_errorf(WS2811_ERROR_MAILBOX_DEVICE, "mem_free", "handle %#x status %#x", handle, p[5])
+	}
+	return nil
 }
 
-// TODO @jmbarzee deal with strange error handling
-func mem_lock(file *os.File, handle uint32) uint32 {
+func mem_lock(mbox Mailbox, handle uint32) (uint32, error) {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -173,15 +198,18 @@ func mem_lock(file *os.File, handle uint32) uint32 {
 	p[6] = 0x00000000                      // end tag
 	p[0] = 7 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	err := mbox_property(file, unsafe.Pointer(&p))
+	err := mbox_property(mbox, p)
 	if err != nil {
-		return ^uint32(0)
-		// TODO @jmbarze wtf is this return for
+		return ^uint32(0), ws2811_error(WS2811_ERROR_MEM_LOCK, "mem_lock", err)
+	}
+	// The firmware replies 0 for a bad handle, ~0 is kept from the C library
+	if p[5] == 0 || p[5] == ^uint32(0) {
+		return ^uint32(0), ws2811_errorf(WS2811_ERROR_MEM_LOCK, "mem_lock", "handle %#x", handle)
 	}
-	return p[5]
+	return p[5], nil
 }
 
-func mem_unlock(file *os.File, handle uint32) uint32 {
+func mem_unlock(mbox Mailbox, handle uint32) error {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -195,15 +223,19 @@ func mem_unlock(file *os.File, handle uint32) uint32 {
 	p[6] = 0x00000000                      // end tag
 	p[0] = 7 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	mbox_property(file, unsafe.Pointer(&p))
-	// TODO @jmbarze error check
-
-	return p[5]
+	err := mbox_property(mbox, p)
+	if err != nil {
+		return err
+	}
+	if p[5] != 0 {
+		return ws2811_errorf(WS2811_ERROR_MEM_LOCK, "mem_unlock", "handle %#x status %#x", handle, p[5])
+	}
+	return nil
 }
 
 // TODO @jmbarzee tripple check this shit. Its crazy
-func execute_code(file *os.File, code uint32, r0 uint32, r1 uint32,
-	r2 uint32, r3 uint32, r4 uint32, r5 uint32) uint32 {
+func execute_code(mbox Mailbox, code uint32, r0 uint32, r1 uint32,
+	r2 uint32, r3 uint32, r4 uint32, r5 uint32) (uint32, error) {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -223,13 +255,18 @@ func execute_code(file *os.File, code uint32, r0 uint32, r1 uint32,
 	p[12] = 0x00000000                      // end tag
 	p[0] = 13 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	mbox_property(file, unsafe.Pointer(&p))
-	// TODO @jmbarze error check
-
-	return p[5]
+	err := mbox_property(mbox, p)
+	if err != nil {
+		return 0, ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "execute_code", err)
+	}
+	// r0 can be anything, only a tag left unanswered tells the code didn't run
+	if p[4]&MBOX_TAG_RESPONSE == 0 {
+		return 0, ws2811_errorf(WS2811_ERROR_MAILBOX_DEVICE, "execute_code", "code %#x not run", code)
+	}
+	return p[5], nil
 }
 
-func qpu_enable(file *os.File, enable uint32) uint32 {
+func qpu_enable(mbox Mailbox, enable uint32) error {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -243,14 +280,18 @@ func qpu_enable(file *os.File, enable uint32) uint32 {
 	p[6] = 0x00000000                      // end tag
 	p[0] = 7 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	mbox_property(file, unsafe.Pointer(&p))
-	// TODO @jmbarze error check
-
-	return p[5]
+	err := mbox_property(mbox, p)
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "qpu_enable", err)
+	}
+	if p[5] != 0 {
+		return ws2811_errorf(WS2811_ERROR_MAILBOX_DEVICE, "qpu_enable", "enable %v status %#x", enable, p[5])
+	}
+	return nil
 }
 
-func execute_qpu(file *os.File, num_qpus uint32, control uint32,
-	noflush uint32, timeout uint32) uint32 {
+func execute_qpu(mbox Mailbox, num_qpus uint32, control uint32,
+	noflush uint32, timeout uint32) error {
 	p := make([]uint32, 32)
 
 	p[0] = 0          // size
@@ -266,10 +307,14 @@ func execute_qpu(file *os.File, num_qpus uint32, control uint32,
 	p[9] = 0x00000000                       // end tag
 	p[0] = 10 * uint32(unsafe.Sizeof(p[0])) // actual size
 
-	mbox_property(file, unsafe.Pointer(&p))
-	// TODO @jmbarze error check
-
-	return p[5]
+	err := mbox_property(mbox, p)
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "execute_qpu", err)
+	}
+	if p[5] != 0 {
+		return ws2811_errorf(WS2811_ERROR_MAILBOX_DEVICE, "execute_qpu", "%v QPUs status %#x", num_qpus, p[5])
+	}
+	return nil
 }
 
 // **** <makedev.c> ****
@@ -293,10 +338,58 @@ func gnu_dev_makedev(major uint32, minor uint32) dev_t {
 
 // **** </makedev.c> ****
 
+// Mailbox sends property messages to the VideoCore firmware.
+type Mailbox interface {
+	// Property sends the property message buf and overwrites it with the reply.
+	Property(buf []uint32) error
+	// Close closes the mailbox.
+	Close() error
+}
+
+// VideoCore opens mailboxes to the VideoCore firmware, which allocates the
+// memory the DMA controller reads the LEDs from.
+type VideoCore interface {
+	Open() (Mailbox, error)
+}
+
+// VCIO reaches the firmware through /dev/vcio, or through a mailbox device
+// node made for the purpose on kernels without it.
+type VCIO struct{}
+
+var _ VideoCore = VCIO{}
+
+// Open opens a mailbox to the firmware.
+func (VCIO) Open() (Mailbox, error) {
+	file, err := mbox_open()
+	if err != nil {
+		return nil, err
+	}
+	return &vcio_mailbox{
+		file: file,
+	}, nil
+}
+
+// vcio_mailbox sends property messages with an ioctl on the mailbox device.
+type vcio_mailbox struct {
+	file *os.File
+}
+
+func (mbox *vcio_mailbox) Property(buf []uint32) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, mbox.file.Fd(), uintptr(IOCTL_MBOX_PROPERTY), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (mbox *vcio_mailbox) Close() error {
+	return mbox.file.Close()
+}
+
 func mbox_open() (*os.File, error) {
 
 	file, err := os.OpenFile("/dev/vcio", 0, 0)
-	if file.Fd() >= 0 {
+	if err == nil {
 		return file, nil
 	}
 
@@ -305,14 +398,12 @@ func mbox_open() (*os.File, error) {
 	syscall.Unlink(filename)
 	err = syscall.Mknod(filename, syscall.S_IFCHR|0600, int(gnu_dev_makedev(100, 0)))
 	if err != nil {
-		log.Printf("Failed to create mailbox device\n")
-		return nil, err
+		return nil, ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "mbox_open", fmt.Errorf("mknod %v: %w", filename, err))
 	}
 	file, err = os.OpenFile(filename, 0, 0)
 	if err != nil {
-		log.Printf("Can't open device file: %v", err)
 		syscall.Unlink(filename)
-		return nil, err
+		return nil, ws2811_error(WS2811_ERROR_MAILBOX_DEVICE, "mbox_open", err)
 	}
 	syscall.Unlink(filename)
 
@@ -0,0 +1,72 @@
+package rpiws2811
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMailboxCodeAndQPU(t *testing.T) {
+	vc := NewFakeVideoCore()
+	mbox, err := vc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vc.Check(t)
+	defer mbox.Close()
+
+	if r0, err := execute_code(mbox, 0x1000, 1, 2, 3, 4, 5, 6); err != nil || r0 != 0 {
+		t.Errorf("execute_code: %#x, %v, want 0", r0, err)
+	}
+	// QPUs run once enabled
+	if err := execute_qpu(mbox, 1, 0x1000, 0, 100); !errors.Is(err, ErrMailbox) {
+		t.Errorf("execute_qpu before qpu_enable: %v, want ErrMailbox", err)
+	}
+	if err := qpu_enable(mbox, 1); err != nil {
+		t.Errorf("qpu_enable: %v", err)
+	}
+	if err := execute_qpu(mbox, 1, 0x1000, 0, 100); err != nil {
+		t.Errorf("execute_qpu: %v", err)
+	}
+}
+
+func TestMailboxCodeAndQPUFailure(t *testing.T) {
+	calls := []struct {
+		name string
+		tag  uint32
+		call func(mbox Mailbox) error
+	}{
+		{"execute_code", MBOX_TAG_EXECUTE_CODE, func(mbox Mailbox) error {
+			_, err := execute_code(mbox, 0x1000, 1, 2, 3, 4, 5, 6)
+			return err
+		}},
+		{"qpu_enable", MBOX_TAG_ENABLE_QPU, func(mbox Mailbox) error {
+			return qpu_enable(mbox, 1)
+		}},
+		{"execute_qpu", MBOX_TAG_EXECUTE_QPU, func(mbox Mailbox) error {
+			if err := qpu_enable(mbox, 1); err != nil {
+				return err
+			}
+			return execute_qpu(mbox, 1, 0x1000, 0, 100)
+		}},
+	}
+
+	for _, call := range calls {
+		vc := NewFakeVideoCore()
+		vc.FailTag(call.tag)
+		mbox, err := vc.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := call.call(mbox); !errors.Is(err, ErrMailbox) {
+			t.Errorf("%v: failing tag %#x: %v, want ErrMailbox", call.name, call.tag, err)
+		}
+
+		// The error of the mailbox itself is kept
+		mbox.Close()
+		if err := call.call(mbox); !errors.Is(err, ErrMailbox) || !errors.Is(err, os.ErrClosed) {
+			t.Errorf("%v: closed mailbox: %v, want ErrMailbox and os.ErrClosed", call.name, err)
+		}
+		vc.Check(t)
+	}
+}
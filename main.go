@@ -1,85 +1,283 @@
 package rpiws2811
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
-const (
-// STRIP_TYPE            WS2811_STRIP_RGB		// WS2812/SK6812RGB integrated chip+leds
-// STRIP_TYPE            WS2811_STRIP_GBR       // WS2812/SK6812RGB integrated chip+leds
-// STRIP_TYPE            SK6812_STRIP_RGBW		// SK6812RGBW (NOT SK6812RGB)
-)
+// StrandOption configures optional behaviour of a strand created by NewLEDStrand.
+type StrandOption func(*LEDStrand)
 
-var (
+// WithSPIDevice sets the spidev device used when channel 0 is on an SPI-MOSI
+// gpio. It defaults to the one of the controller of the gpio, /dev/spidev0.0
+// for GPIO 10. Any other file works too, in which case the encoded frames are
+// written to it without configuring an SPI controller.
+func WithSPIDevice(path string) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.spi_dev = path
+	}
+}
 
-	// TODO @jmbarzee global variables to remove
-	running       = true
-	clear_on_exit = false
-)
+// WithSignalHandling makes Run stop on SIGINT and SIGTERM.
+func WithSignalHandling() StrandOption {
+	return func(strand *LEDStrand) {
+		strand.handle_signals = true
+	}
+}
 
-func init_handlers() {
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		running = false // TODO @jbarzee
-		// change this to follow normal go conventions for passing messaging
-	}()
+// WithPeripheralMemory sets the physical memory the registers and the DMA
+// buffer are mapped from. It defaults to /dev/mem, a FakeMemory runs the
+// driver without a Pi.
+func WithPeripheralMemory(mem PeripheralMemory) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.mem = mem
+	}
+}
+
+// WithVideoCore sets the firmware the DMA buffer is allocated from through
+// the mailbox. It defaults to VCIO, a FakeVideoCore runs the driver without a Pi.
+func WithVideoCore(videocore VideoCore) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.videocore = videocore
+	}
 }
 
-func main() {
-	init_handlers()
+// WithFrameSink passes every frame rendered by the strand to sink, after it
+// was sent to the LEDs.
+func WithFrameSink(sink FrameSink) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.sinks = append(strand.sinks, sink)
+	}
+}
 
-	// Create Channels
-	c1, err := NewLEDStrandChannel(12, 30, 255, false, SK6812_STRIP_RGBW)
-	if err != nil {
-		panic(err)
+// WithSimulator replaces the hardware by sim, such as a Terminal. Nothing is
+// mapped and no Pi is needed, every rendered frame is only passed to sim and
+// the other frame sinks. The GPIOs of the channels still select PWM, PCM or
+// SPI, whose encoding is simulated.
+func WithSimulator(sim FrameSink) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.simulate = true
+		strand.sinks = append(strand.sinks, sim)
 	}
-	c2, err := NewLEDStrandChannel(0, 0, 0, false, SK6812_STRIP_RGBW)
-	if err != nil {
-		panic(err)
+}
+
+// WithClock sets the clock the strand waits on, for the hardware and between
+// renders. It defaults to SystemClock, a FakeClock runs the strand on virtual time.
+func WithClock(clock Clock) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.clock = clock
 	}
+}
 
-	// Create Strand
-	_, err = NewLEDStrand(
-		WS2811_TARGET_FREQ,
-		10, // DMA
-		true,
-		c1,
-		c2,
-	)
-	if err != nil {
-		panic(err)
+// WithScheduler makes Run pace the frames with sched, rather than rendering
+// them as fast as the strip takes them. sched uses the clock of the strand
+// when it has none.
+func WithScheduler(sched *Scheduler) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.scheduler = sched
 	}
+}
 
-	//TODO @jmbarzee use strand
+// WithCPUInfo sets the file the board is detected from by its revision code.
+// It defaults to /proc/cpuinfo, a copy of the one of another board detects it
+// instead.
+func WithCPUInfo(path string) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.cpuinfo = path
+	}
 }
 
-func NewLEDStrand(freq uint32, dma int, clearOnExit bool, c1, c2 ws2811_channel_t) (ws2811_t, error) {
-	strand := ws2811_t{}
+// WithDeviceTree sets the root of the device tree the peripheral base and the
+// VideoCore alias are read from, and the board when cpuinfo has no revision
+// code. It defaults to /proc/device-tree, "" only uses the revision code.
+func WithDeviceTree(root string) StrandOption {
+	return func(strand *LEDStrand) {
+		strand.device_tree = root
+	}
+}
 
-	clear_on_exit = clearOnExit
+func NewLEDStrand(freq uint32, dma int, clearOnExit bool, c1, c2 LEDStrandChannel, opts ...StrandOption) (*LEDStrand, error) {
+	strand := &LEDStrand{
+		clear_on_exit: clearOnExit,
+		mem:           DevMem{Path: DEV_MEM},
+		videocore:     VCIO{},
+		clock:         SystemClock{},
+		cpuinfo:       PROC_CPUINFO,
+		device_tree:   DEVICE_TREE,
+	}
 
-	if dma < 14 {
-		return strand, fmt.Errorf("invalid dma %v\n", dma)
+	if dmanum_to_offset(dma) == 0 {
+		return nil, ws2811_errorf(WS2811_ERROR_DMA, "NewLEDStrand", "invalid dma %v", dma)
 	}
 	strand.dmanum = dma
 
 	if freq < 400000 || freq > 800000 {
-		return strand, fmt.Errorf("invalid freq %v\n", freq)
+		return nil, ws2811_errorf(WS2811_ERROR_GENERIC, "NewLEDStrand", "invalid freq %v", freq)
 	}
 	strand.freq = freq
 
-	strand.channel = [RPI_PWM_CHANNELS]ws2811_channel_t{
+	strand.channel = [RPI_PWM_CHANNELS]LEDStrandChannel{
 		c1,
 		c2,
 	}
+
+	for _, opt := range opts {
+		opt(strand)
+	}
+	if strand.scheduler != nil && strand.scheduler.Clock == nil {
+		strand.scheduler.Clock = strand.clock
+	}
+
+	if err := ws2811_init(strand); err != nil {
+		return nil, err
+	}
 	return strand, nil
 }
 
-func NewLEDStrandChannel(gpio, length, brightness int, invert bool, LEDType LEDType) (ws2811_channel_t, error) {
+var _ io.Closer = (*LEDStrand)(nil)
+
+// Render encodes the LEDs of both channels into the DMA buffer and starts
+// sending them to the strip, first waiting out any previous render.
+func (strand *LEDStrand) Render() error {
+	if strand.device == nil {
+		return ErrClosed
+	}
+	return ws2811_render(strand)
+}
+
+// Wait blocks until the DMA transfer started by the last Render has completed.
+func (strand *LEDStrand) Wait() error {
+	if strand.device == nil {
+		return ErrClosed
+	}
+	return ws2811_wait(strand)
+}
+
+// Close stops the PWM/PCM, blanks the strip if it should be cleared on exit,
+// and releases the registers, the VideoCore memory and the mailbox.
+// Errors from every step are joined together. Closing twice is a no-op.
+func (strand *LEDStrand) Close() error {
+	if strand.device == nil {
+		return nil
+	}
+	return ws2811_fini(strand)
+}
+
+// Run calls render and then Render until ctx is done or either of them fails,
+// once per frame of the Scheduler given WithScheduler if any.
+// The strand is closed when Run returns, even if render panics, so it is
+// blanked when it was created to be cleared on exit and its resources released.
+func (strand *LEDStrand) Run(ctx context.Context, render func(strand *LEDStrand) error) (err error) {
+	if strand.device == nil {
+		return ErrClosed
+	}
+
+	if strand.handle_signals {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	defer func() {
+		err = errors.Join(err, strand.Close())
+	}()
+
+	for ctx.Err() == nil {
+		if strand.scheduler != nil {
+			if _, err := strand.scheduler.Wait(ctx); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return err
+			}
+		}
+		if err := render(strand); err != nil {
+			return err
+		}
+		if err := strand.Render(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Waveform describes how Render encodes the LEDs of the strand into Raw.
+func (strand *LEDStrand) Waveform() Waveform {
+	waveform := Waveform{
+		Freq: strand.freq,
+	}
+	if strand.device != nil {
+		waveform.DriverMode = strand.device.driver_mode
+	}
+	if strand.rpi_hw != nil {
+		waveform.OscFreq = osc_freq(strand.rpi_hw)
+	}
+	for i, channel := range strand.channel {
+		waveform.StripType[i] = channel.strip_type
+		waveform.Invert[i] = channel.invert
+	}
+	return waveform
+}
+
+// FrameRate returns the frames per second Render achieves, as a moving
+// average, 0 until it rendered twice.
+func (strand *LEDStrand) FrameRate() float64 {
+	return strand.frame_rate
+}
+
+// Hardware describes a board driving LEDs.
+type Hardware struct {
+	Revision      uint32 // Revision code, 0 if the board is only known from its device tree
+	Model         string
+	PeriphBase    uint32 // Physical address of the peripherals
+	VideoCoreBase uint32 // Bus alias the DMA buffer is allocated through
+	Mismatch      error  // How the device tree disagrees with the revision code, nil if it doesn't
+}
+
+// Hardware describes the board of the strand, as detected when it was created.
+func (strand *LEDStrand) Hardware() Hardware {
+	rpi_hw := strand.rpi_hw
+	if rpi_hw == nil {
+		return Hardware{}
+	}
+	return Hardware{
+		Revision:      rpi_hw.hwver,
+		Model:         rpi_hw.desc,
+		PeriphBase:    rpi_hw.periph_base,
+		VideoCoreBase: rpi_hw.videocore_base,
+		Mismatch:      rpi_hw.mismatch,
+	}
+}
+
+// Raw returns the part of the DMA buffer sent to the strip, holding the LEDs
+// as encoded by the last Render. It is only valid until the strand is closed.
+func (strand *LEDStrand) Raw() []byte {
+	device := strand.device
+	if device == nil {
+		return nil
+	}
+
+	byte_count := PCM_BYTE_COUNT(device.max_count, strand.freq)
+	if device.driver_mode == PWM {
+		byte_count = PWM_BYTE_COUNT(device.max_count, strand.freq)
+	}
+	return device.pxl_raw[:byte_count]
+}
+
+// Channel returns channel i of the strand, 0 or 1, whose LEDs are sent by Render.
+func (strand *LEDStrand) Channel(i int) (*LEDStrandChannel, error) {
+	if i < 0 || i >= len(strand.channel) {
+		return nil, fmt.Errorf("%w: channel %v not in [0, %v)", ErrOutOfRange, i, len(strand.channel))
+	}
+	return &strand.channel[i], nil
+}
+
+func NewLEDStrandChannel(gpio, length, brightness int, invert bool, LEDType LEDType) (LEDStrandChannel, error) {
 
 	/*              ====== GPIO ======
 	PWM0, which can be set to use GPIOs 12, 18, 40, and 52.
@@ -90,17 +288,25 @@ func NewLEDStrandChannel(gpio, length, brightness int, invert bool, LEDType LEDT
 	Only 21 is available on the B+/2B/PiZero/3B, on pin 40.
 	SPI0-MOSI is available on GPIOs 10 and 38.
 	Only GPIO 10 is available on all models.
+	SPI3-MOSI to SPI6-MOSI are available on GPIOs 2, 6, 14 and 20 of the Pi 4.
 
-	The library checks if the specified gpio is available
-	on the specific model (from model B rev 1 till 3B)
+	The library checks if the specified gpio is broken out with one
+	of these functions on the specific model (from model B rev 1 till 4B,
+	the Zero and the Compute Modules). SetPin also takes a header
+	pin like "pin 12" or a function like "PWM1" instead.
 	*/
-	channel := ws2811_channel_t{}
+	channel := LEDStrandChannel{}
 
 	if length < 0 {
-		return channel, fmt.Errorf("invalid length %v\n", length)
+		return channel, ws2811_errorf(WS2811_ERROR_GENERIC, "NewLEDStrandChannel", "invalid length %v", length)
 	}
 	channel.count = length
 
+	if brightness < 0 || brightness > 255 {
+		return channel, ws2811_errorf(WS2811_ERROR_GENERIC, "NewLEDStrandChannel", "invalid brightness %v", brightness)
+	}
+	channel.brightness = byte(brightness)
+
 	channel.gpionum = gpio
 	channel.invert = invert
 	channel.strip_type = LEDType
@@ -0,0 +1,79 @@
+package rpiws2811
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunStopsOnCancel(t *testing.T) {
+	strand, mem, vc := fake_strand(t, 18, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := 0
+	err := strand.Run(ctx, func(strand *LEDStrand) error {
+		frames++
+		if frames == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	if frames != 3 {
+		t.Errorf("rendered %v frames after cancelling on the third", frames)
+	}
+
+	if err := strand.Render(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Render after Run: %v, want ErrClosed", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Run", n)
+	}
+	vc.Check(t)
+}
+
+func TestRunClosesOnError(t *testing.T) {
+	strand, mem, vc := fake_strand(t, 18, true)
+	failure := errors.New("render failed")
+
+	err := strand.Run(context.Background(), func(strand *LEDStrand) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Run: %v, want %v", err, failure)
+	}
+
+	if err := strand.Render(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Render after Run: %v, want ErrClosed", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Run", n)
+	}
+	vc.Check(t)
+}
+
+func TestRunClosesOnPanic(t *testing.T) {
+	strand, mem, vc := fake_strand(t, 18, true)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "render panicked" {
+				t.Errorf("recovered %v, want the panic of render", r)
+			}
+		}()
+		strand.Run(context.Background(), func(strand *LEDStrand) error {
+			panic("render panicked")
+		})
+	}()
+
+	if err := strand.Render(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Render after Run: %v, want ErrClosed", err)
+	}
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Run", n)
+	}
+	vc.Check(t)
+}
@@ -1,6 +1,6 @@
 package rpiws2811
 
-import "fmt"
+import "unsafe"
 
 // **** <pcm.h> ****
 
@@ -136,6 +136,19 @@ type pcm_t struct {
 	gray   uint32
 } // TODD @jmbarzee __attribute__((packed, aligned(4)))
 
+// Register offsets in pcm_t
+const (
+	PCM_CS     = unsafe.Offsetof(pcm_t{}.cs)
+	PCM_FIFO   = unsafe.Offsetof(pcm_t{}.fifo)
+	PCM_MODE   = unsafe.Offsetof(pcm_t{}.mode)
+	PCM_RXC    = unsafe.Offsetof(pcm_t{}.rxc)
+	PCM_TXC    = unsafe.Offsetof(pcm_t{}.txc)
+	PCM_DREQ   = unsafe.Offsetof(pcm_t{}.dreq)
+	PCM_INTEN  = unsafe.Offsetof(pcm_t{}.inten)
+	PCM_INTSTC = unsafe.Offsetof(pcm_t{}.intstc)
+	PCM_GRAY   = unsafe.Offsetof(pcm_t{}.gray)
+)
+
 const (
 	PCM_OFFSET      = 0x00203000
 	PCM_PERIPH_PHYS = 0x7e203000
@@ -218,7 +231,7 @@ var pcm_pin_tables = [NUM_PCMFUNS]pcm_pin_tables_t{
 
 func pcm_pin_alt(pcmfun int, pinnum int) (int, error) {
 	if pcmfun < 0 || pcmfun > 3 {
-		return 0, fmt.Errorf("pcmfun out of acceptable range: %v", pcmfun)
+		return 0, ws2811_errorf(WS2811_ERROR_GENERIC, "pcm_pin_alt", "pcmfun out of acceptable range: %v", pcmfun)
 	}
 	pins := pcm_pin_tables[pcmfun].pins
 
@@ -228,7 +241,7 @@ func pcm_pin_alt(pcmfun int, pinnum int) (int, error) {
 		}
 	}
 
-	return 0, fmt.Errorf("no alternate pin found for pin: %v", pcmfun)
+	return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "pcm_pin_alt", "no alternate function found for pcmfun %v on pin %v", pcmfun, pinnum)
 }
 
 // **** </pcm.c> ****
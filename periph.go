@@ -0,0 +1,81 @@
+package rpiws2811
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// PeripheralMemory maps the physical memory holding the peripheral registers
+// and the DMA buffer. The driver reaches every register through it, so it runs
+// against DevMem on a Pi and against a FakeMemory anywhere else.
+type PeripheralMemory interface {
+	// Map maps size bytes of physical memory starting at addr.
+	Map(addr uint32, size uintptr) (Registers, error)
+}
+
+// Registers is a range of physical memory mapped by a PeripheralMemory.
+type Registers interface {
+	// Read32 reads the 32-bit register offset bytes into the range.
+	Read32(offset uintptr) uint32
+	// Write32 writes the 32-bit register offset bytes into the range.
+	Write32(offset uintptr, val uint32)
+	// Pointer returns the start of the range, for memory shared with the DMA controller.
+	Pointer() unsafe.Pointer
+	// Unmap releases the range, it must not be used afterwards.
+	Unmap() error
+}
+
+// DevMem maps physical memory through a memory device such as /dev/mem.
+type DevMem struct {
+	Path string
+}
+
+var _ PeripheralMemory = DevMem{}
+
+// Map maps size bytes at addr of the memory device with mmap.
+func (mem DevMem) Map(addr uint32, size uintptr) (Registers, error) {
+	ptr, mapping, err := mapmem(addr, size, mem.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &devmem_regs{
+		addr:    ptr,
+		mapping: mapping,
+	}, nil
+}
+
+// devmem_regs are registers mmapped from a memory device. Every access is
+// atomic so the compiler neither caches nor reorders them, like volatile in C.
+type devmem_regs struct {
+	addr    unsafe.Pointer
+	mapping []byte // Whole mapping, from the page boundary before addr
+}
+
+func (regs *devmem_regs) Read32(offset uintptr) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Add(regs.addr, offset)))
+}
+
+func (regs *devmem_regs) Write32(offset uintptr, val uint32) {
+	atomic.StoreUint32((*uint32)(unsafe.Add(regs.addr, offset)), val)
+}
+
+func (regs *devmem_regs) Pointer() unsafe.Pointer {
+	return regs.addr
+}
+
+func (regs *devmem_regs) Unmap() error {
+	return unmapmem(regs.mapping)
+}
+
+/**
+ * Set the bits of a register which are set in mask, keeping the others.
+ *
+ * @param    regs    mapped registers.
+ * @param    offset  offset of the register.
+ * @param    mask    bits to set.
+ *
+ * @returns  None
+ */
+func reg_set(regs Registers, offset uintptr, mask uint32) {
+	regs.Write32(offset, regs.Read32(offset)|mask)
+}
@@ -0,0 +1,418 @@
+package rpiws2811
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// Appended to the key of the client to accept a WebSocket, RFC 6455 section 1.3
+	WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// The only version of the protocol, RFC 6455 section 4.4
+	WEBSOCKET_VERSION = "13"
+
+	WEBSOCKET_OP_TEXT  = 0x1
+	WEBSOCKET_OP_CLOSE = 0x8
+	WEBSOCKET_OP_PING  = 0x9
+	WEBSOCKET_OP_PONG  = 0xa
+
+	// Largest message read from a client, which has nothing to say but control frames
+	WEBSOCKET_MAX_READ = 1 << 16
+)
+
+// Preview is a FrameSink showing the LEDs live in a browser. It serves a page
+// at / which draws every channel in its Layout, and streams every frame to it
+// over a WebSocket at /ws. Pages of other sites can't connect to the WebSocket.
+//
+// The colors are decoded from the encoded frames, so the preview shows what
+// the strips were sent, after brightness and gamma. Slow browsers skip frames.
+type Preview struct {
+	mu      sync.Mutex
+	clients map[*preview_client]bool
+	last    []byte // Last frame, for new clients
+}
+
+// preview_client is a browser connected to a Preview.
+type preview_client struct {
+	conn   net.Conn
+	frames chan []byte // Holds the latest frame not sent yet
+	done   chan struct{}
+	once   sync.Once
+}
+
+// preview_channel is how a channel is sent to the browsers.
+type preview_channel struct {
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	LEDs   []string `json:"leds"` // By row, "#rrggbb" or "" where the grid has no LED
+}
+
+var _ FrameSink = (*Preview)(nil)
+var _ http.Handler = (*Preview)(nil)
+
+// NewPreview returns a Preview without any browser connected.
+func NewPreview() *Preview {
+	return &Preview{
+		clients: map[*preview_client]bool{},
+	}
+}
+
+// ListenAndServe serves the preview on the TCP address addr, like ":8080".
+func (preview *Preview) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, preview)
+}
+
+// ServeHTTP serves the page at / and the WebSocket at /ws.
+func (preview *Preview) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, PREVIEW_PAGE)
+	case "/ws":
+		preview.serve_websocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Frame sends frame to every browser connected.
+func (preview *Preview) Frame(frame Frame) error {
+	leds, err := frame.LEDs()
+	if err != nil {
+		return err
+	}
+
+	message := struct {
+		Time     int64             `json:"time"` // ms since the epoch
+		Channels []preview_channel `json:"channels"`
+	}{
+		Time: frame.Time.UnixNano() / 1e6,
+	}
+	for channum, channel := range leds {
+		if len(channel) == 0 {
+			continue
+		}
+
+		layout := frame.Layout[channum]
+		width, height := layout.Size(len(channel))
+		grid := make([]string, width*height)
+		for i, led := range channel {
+			x, y := layout.Position(i)
+			r, g, b := led_rgb(led)
+			grid[y*width+x] = fmt.Sprintf("#%02x%02x%02x", r, g, b)
+		}
+		message.Channels = append(message.Channels, preview_channel{
+			Width:  width,
+			Height: height,
+			LEDs:   grid,
+		})
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	preview.mu.Lock()
+	defer preview.mu.Unlock()
+
+	preview.last = data
+	for client := range preview.clients {
+		client.send(data)
+	}
+	return nil
+}
+
+/**
+ * Upgrade a request to a WebSocket and stream the frames over it until the
+ * browser goes away.
+ *
+ * @param    w  response of the request.
+ * @param    r  request.
+ *
+ * @returns  None
+ */
+func (preview *Preview) serve_websocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if version := r.Header.Get("Sec-WebSocket-Version"); version != WEBSOCKET_VERSION {
+		w.Header().Set("Sec-WebSocket-Version", WEBSOCKET_VERSION)
+		http.Error(w, fmt.Sprintf("unsupported WebSocket version %q", version), http.StatusUpgradeRequired)
+		return
+	}
+	if !websocket_same_origin(r) {
+		http.Error(w, "cross-origin WebSocket", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	accept := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n")
+	fmt.Fprintf(rw, "Upgrade: websocket\r\n")
+	fmt.Fprintf(rw, "Connection: Upgrade\r\n")
+	fmt.Fprintf(rw, "Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	client := &preview_client{
+		conn:   conn,
+		frames: make(chan []byte, 1),
+		done:   make(chan struct{}),
+	}
+
+	preview.mu.Lock()
+	preview.clients[client] = true
+	if preview.last != nil {
+		client.send(preview.last)
+	}
+	preview.mu.Unlock()
+
+	go client.write_frames()
+	client.read_frames(rw.Reader)
+
+	preview.mu.Lock()
+	delete(preview.clients, client)
+	preview.mu.Unlock()
+}
+
+/**
+ * Check a WebSocket request comes from a page of the preview. Browsers send
+ * the origin of the page, other clients needn't.
+ *
+ * @param    r  request.
+ *
+ * @returns  true without an Origin or with the one of the host, false otherwise
+ */
+func websocket_same_origin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// send queues data for the browser, replacing the frame it didn't get yet.
+func (client *preview_client) send(data []byte) {
+	select {
+	case <-client.frames:
+	default:
+	}
+	client.frames <- data
+}
+
+func (client *preview_client) close() {
+	client.once.Do(func() {
+		close(client.done)
+		client.conn.Close()
+	})
+}
+
+// write_frames sends the queued frames until the client is closed.
+func (client *preview_client) write_frames() {
+	defer client.close()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case data := <-client.frames:
+			if err := websocket_write(client.conn, WEBSOCKET_OP_TEXT, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// read_frames answers the control frames of the browser until it closes.
+func (client *preview_client) read_frames(r *bufio.Reader) {
+	defer client.close()
+
+	for {
+		opcode, payload, err := websocket_read(r)
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case WEBSOCKET_OP_CLOSE:
+			websocket_write(client.conn, WEBSOCKET_OP_CLOSE, payload)
+			return
+		case WEBSOCKET_OP_PING:
+			if err := websocket_write(client.conn, WEBSOCKET_OP_PONG, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/**
+ * Write an unmasked, unfragmented WebSocket frame as servers send them.
+ *
+ * @param    w        connection.
+ * @param    opcode   WEBSOCKET_OP_xxx.
+ * @param    payload  data of the frame.
+ *
+ * @returns  nil on success, error otherwise
+ */
+func websocket_write(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode} // FIN
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+/**
+ * Read a masked WebSocket frame as clients send them.
+ *
+ * @param    r  connection.
+ *
+ * @returns  opcode and unmasked payload of the frame, error otherwise
+ */
+func websocket_read(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	if (header[1] & 0x80) == 0 {
+		return 0, nil, errors.New("websocket: unmasked client frame")
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > WEBSOCKET_MAX_READ {
+		return 0, nil, fmt.Errorf("websocket: %v byte frame is too large", length)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// The page of the preview, drawing the channels on canvases from the frames of /ws.
+const PREVIEW_PAGE = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rpiws2811 preview</title>
+<style>
+body { background: #111; color: #ccc; font-family: sans-serif; }
+canvas { display: block; margin: 1em 0; }
+</style>
+</head>
+<body>
+<div id="status">connecting</div>
+<div id="channels"></div>
+<script>
+const SIZE = 16;
+const channels = document.getElementById("channels");
+const status = document.getElementById("status");
+
+function draw(frame) {
+	while (channels.children.length > frame.channels.length) {
+		channels.lastChild.remove();
+	}
+	frame.channels.forEach((channel, i) => {
+		let canvas = channels.children[i];
+		if (!canvas) {
+			canvas = document.createElement("canvas");
+			channels.appendChild(canvas);
+		}
+		canvas.width = channel.width * SIZE;
+		canvas.height = channel.height * SIZE;
+		const ctx = canvas.getContext("2d");
+		ctx.fillStyle = "#000";
+		ctx.fillRect(0, 0, canvas.width, canvas.height);
+		channel.leds.forEach((color, j) => {
+			if (!color) {
+				return;
+			}
+			const x = j % channel.width, y = Math.floor(j / channel.width);
+			ctx.fillStyle = color;
+			ctx.beginPath();
+			ctx.arc((x + 0.5) * SIZE, (y + 0.5) * SIZE, SIZE * 0.4, 0, 2 * Math.PI);
+			ctx.fill();
+		});
+	});
+}
+
+function connect() {
+	const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+	ws.onopen = () => { status.textContent = "connected"; };
+	ws.onmessage = (event) => {
+		const frame = JSON.parse(event.data);
+		status.textContent = new Date(frame.time).toISOString();
+		draw(frame);
+	};
+	ws.onclose = () => {
+		status.textContent = "disconnected, retrying";
+		setTimeout(connect, 1000);
+	};
+}
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,210 @@
+package rpiws2811
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/**
+ * Send a WebSocket handshake to a preview.
+ *
+ * @param    t       test.
+ * @param    server  server of the preview.
+ * @param    header  headers replacing the ones of a valid handshake, "" to
+ *                   remove one.
+ *
+ * @returns  connection, its reader past the response and the response
+ */
+func dial_preview(t *testing.T, server *httptest.Server, header map[string]string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Origin", server.URL)
+	for key, value := range header {
+		req.Header.Del(key)
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, r, resp
+}
+
+/**
+ * Read an unmasked WebSocket frame as servers send them.
+ *
+ * @param    t  test.
+ * @param    r  connection.
+ *
+ * @returns  opcode and payload of the frame
+ */
+func read_server_frame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("frame header %#x, want a final unmasked frame", header)
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		t.Fatalf("%v byte frame", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestPreviewWebSocket(t *testing.T) {
+	preview := NewPreview()
+	server := httptest.NewServer(preview)
+	defer server.Close()
+
+	c1, err := NewLEDStrandChannel(18, 2, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+		WithSimulator(preview),
+		WithClock(NewFakeClock(time.Unix(1, 0))))
+	if err != nil {
+		t.Fatalf("NewLEDStrand: %v", err)
+	}
+	defer strand.Close()
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(colors []uint32) {
+		if err := channel.CopyFrom(colors); err != nil {
+			t.Fatal(err)
+		}
+		if err := strand.Render(); err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+	}
+
+	// A new browser gets the last frame, then the ones streamed
+	render([]uint32{0x00ff0000, 0x000000ff})
+	conn, r, resp := dial_preview(t, server, nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: %v, want 101", resp.Status)
+	}
+	// RFC 6455 section 1.3
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept %q", accept)
+	}
+
+	for _, want := range [][]string{{"#ff0000", "#0000ff"}, {"#00ff00", "#000000"}} {
+		opcode, payload := read_server_frame(t, r)
+		if opcode != WEBSOCKET_OP_TEXT {
+			t.Fatalf("opcode %#x, want text", opcode)
+		}
+		var message struct {
+			Time     int64             `json:"time"`
+			Channels []preview_channel `json:"channels"`
+		}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("%v: %s", err, payload)
+		}
+		if message.Time != 1000 {
+			t.Errorf("time %v, want 1000", message.Time)
+		}
+		if len(message.Channels) != 1 || !reflect.DeepEqual(message.Channels[0], preview_channel{Width: 2, Height: 1, LEDs: want}) {
+			t.Errorf("channels %+v, want %v", message.Channels, want)
+		}
+		render([]uint32{0x0000ff00, 0x00000000})
+	}
+
+	// The close frame is echoed
+	close_frame := []byte{0x80 | WEBSOCKET_OP_CLOSE, 0x80 | 2, 1, 2, 3, 4, 0x03 ^ 1, 0xe8 ^ 2}
+	if _, err := conn.Write(close_frame); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		opcode, payload := read_server_frame(t, r)
+		if opcode == WEBSOCKET_OP_CLOSE {
+			if binary.BigEndian.Uint16(payload) != 1000 {
+				t.Errorf("close payload %#x, want status 1000", payload)
+			}
+			break
+		}
+	}
+}
+
+func TestPreviewWebSocketRejected(t *testing.T) {
+	preview := NewPreview()
+	server := httptest.NewServer(preview)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		header  map[string]string
+		status  int
+		version string // Sec-WebSocket-Version of the response
+	}{
+		{"no upgrade", map[string]string{"Upgrade": ""}, http.StatusBadRequest, ""},
+		{"no key", map[string]string{"Sec-WebSocket-Key": ""}, http.StatusBadRequest, ""},
+		{"version 8", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired, "13"},
+		{"no version", map[string]string{"Sec-WebSocket-Version": ""}, http.StatusUpgradeRequired, "13"},
+		{"cross-origin", map[string]string{"Origin": "http://example.com"}, http.StatusForbidden, ""},
+		{"opaque origin", map[string]string{"Origin": "null"}, http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		_, _, resp := dial_preview(t, server, test.header)
+		if resp.StatusCode != test.status {
+			t.Errorf("%v: %v, want %v", test.name, resp.Status, test.status)
+		}
+		if version := resp.Header.Get("Sec-WebSocket-Version"); version != test.version {
+			t.Errorf("%v: Sec-WebSocket-Version %q, want %q", test.name, version, test.version)
+		}
+	}
+
+	// Clients other than browsers send no Origin
+	_, _, resp := dial_preview(t, server, map[string]string{"Origin": ""})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("no origin: %v, want 101", resp.Status)
+	}
+}
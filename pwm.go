@@ -1,6 +1,6 @@
 package rpiws2811
 
-import "fmt"
+import "unsafe"
 
 // **** <pwm.h> ****
 
@@ -56,6 +56,18 @@ type pwm_t struct {
 	dat2       uint32
 } // TODO @jmbarzee __attribute__((packed, aligned(4)))
 
+// Register offsets in pwm_t
+const (
+	PWM_CTL  = unsafe.Offsetof(pwm_t{}.ctl)
+	PWM_STA  = unsafe.Offsetof(pwm_t{}.sta)
+	PWM_DMAC = unsafe.Offsetof(pwm_t{}.dmac)
+	PWM_RNG1 = unsafe.Offsetof(pwm_t{}.rng1)
+	PWM_DAT1 = unsafe.Offsetof(pwm_t{}.dat1)
+	PWM_FIF1 = unsafe.Offsetof(pwm_t{}.fif1)
+	PWM_RNG2 = unsafe.Offsetof(pwm_t{}.rng2)
+	PWM_DAT2 = unsafe.Offsetof(pwm_t{}.dat2)
+)
+
 const (
 	PWM_OFFSET      = 0x0020c000
 	PWM_PERIPH_PHYS = 0x7e20c000
@@ -86,6 +98,9 @@ var pwm_pin_chan0 = []pwm_pin_table_t{
 	pwm_pin_table_t{
 		pinnum: 40,
 		altnum: 0},
+	pwm_pin_table_t{
+		pinnum: 52,
+		altnum: 1},
 }
 
 // Mapping of Pin to alternate function for PWM channel 1
@@ -102,6 +117,9 @@ var pwm_pin_chan1 = []pwm_pin_table_t{
 	pwm_pin_table_t{
 		pinnum: 45,
 		altnum: 0},
+	pwm_pin_table_t{
+		pinnum: 53,
+		altnum: 1},
 }
 
 var pwm_pin_tables = [RPI_PWM_CHANNELS]pwm_pin_tables_t{
@@ -122,7 +140,7 @@ func pwm_pin_alt(channel int, pinnum int) (int, error) {
 		}
 	}
 
-	return 0, fmt.Errorf("no alternate pin found for channel: %v - pin: %v", channel, pinnum)
+	return 0, ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "pwm_pin_alt", "no alternate function found for channel %v on pin %v", channel, pinnum)
 }
 
 // **** </pwm.c> ****
@@ -0,0 +1,216 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"sync"
+	"time"
+)
+
+// Recorder is a FrameSink keeping every frame a strand renders, to export
+// them as a PNG waterfall or an animated GIF.
+//
+// The colors are decoded from the encoded frames, so they are what the strips
+// were sent, after brightness and gamma.
+type Recorder struct {
+	Scale int // Pixels per LED in each direction, 0 is 1
+
+	mu     sync.Mutex
+	frames []recorded_frame
+}
+
+// recorded_frame is a frame decoded by a Recorder.
+type recorded_frame struct {
+	time   time.Time
+	leds   [RPI_PWM_CHANNELS][]uint32
+	layout [RPI_PWM_CHANNELS]Layout
+}
+
+var _ FrameSink = (*Recorder)(nil)
+
+// Frame records frame.
+func (rec *Recorder) Frame(frame Frame) error {
+	leds, err := frame.LEDs()
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.frames = append(rec.frames, recorded_frame{
+		time:   frame.Time,
+		leds:   leds,
+		layout: frame.Layout,
+	})
+	return nil
+}
+
+// Len returns the number of frames recorded.
+func (rec *Recorder) Len() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return len(rec.frames)
+}
+
+// Reset forgets the frames recorded so far.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.frames = nil
+}
+
+// WritePNG writes the frames of channel as a PNG waterfall, one row per frame
+// from the first one down and one column per LED.
+func (rec *Recorder) WritePNG(w io.Writer, channel int) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if channel < 0 || channel >= RPI_PWM_CHANNELS {
+		return fmt.Errorf("no channel %v", channel)
+	}
+	if len(rec.frames) == 0 {
+		return fmt.Errorf("no frames recorded")
+	}
+
+	scale := rec.scale()
+	count := 0
+	for _, frame := range rec.frames {
+		if len(frame.leds[channel]) > count {
+			count = len(frame.leds[channel])
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("no LEDs recorded on channel %v", channel)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, count*scale, len(rec.frames)*scale))
+	for y, frame := range rec.frames {
+		for x, led := range frame.leds[channel] {
+			recorder_fill(img, x, y, scale, led)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// WriteGIF writes the frames of channel as an animated GIF, the LEDs placed
+// as in the Layout of the channel. Each frame lasts until the next one was
+// rendered, the last one as long as the one before it.
+func (rec *Recorder) WriteGIF(w io.Writer, channel int) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if channel < 0 || channel >= RPI_PWM_CHANNELS {
+		return fmt.Errorf("no channel %v", channel)
+	}
+	if len(rec.frames) == 0 {
+		return fmt.Errorf("no frames recorded")
+	}
+
+	scale := rec.scale()
+	anim := &gif.GIF{}
+	delay := 10 // 1/100s, for a single frame
+
+	// The logical screen holds the largest frame, should the layout have changed
+	for _, frame := range rec.frames {
+		width, height := frame.layout[channel].Size(len(frame.leds[channel]))
+		if width*scale > anim.Config.Width {
+			anim.Config.Width = width * scale
+		}
+		if height*scale > anim.Config.Height {
+			anim.Config.Height = height * scale
+		}
+	}
+
+	for i, frame := range rec.frames {
+		leds := frame.leds[channel]
+		if len(leds) == 0 {
+			return fmt.Errorf("no LEDs recorded on channel %v", channel)
+		}
+
+		layout := frame.layout[channel]
+		width, height := layout.Size(len(leds))
+		img := image.NewRGBA(image.Rect(0, 0, width*scale, height*scale))
+		for j, led := range leds {
+			x, y := layout.Position(j)
+			recorder_fill(img, x, y, scale, led)
+		}
+
+		if i+1 < len(rec.frames) {
+			// GIF delays are in 100ths of a second
+			delay = int(rec.frames[i+1].time.Sub(frame.time) / (10 * time.Millisecond))
+			if delay < 1 {
+				delay = 1
+			}
+		}
+
+		anim.Image = append(anim.Image, recorder_paletted(img))
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	return gif.EncodeAll(w, anim)
+}
+
+func (rec *Recorder) scale() int {
+	if rec.Scale <= 0 {
+		return 1
+	}
+	return rec.Scale
+}
+
+/**
+ * Paint the block of an LED.
+ *
+ * @param    img    image to paint.
+ * @param    x      column of the LED.
+ * @param    y      row of the LED.
+ * @param    scale  pixels per LED in each direction.
+ * @param    led    color packed as 0xWWRRGGBB.
+ *
+ * @returns  None
+ */
+func recorder_fill(img *image.RGBA, x, y, scale int, led uint32) {
+	r, g, b := led_rgb(led)
+	c := color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 0xff}
+	rect := image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale)
+	draw.Draw(img, rect, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+/**
+ * Convert an image to a paletted one for GIF, with its exact colors when it
+ * has no more than 256, dithered to the Plan 9 palette otherwise.
+ *
+ * @param    img  image to convert.
+ *
+ * @returns  the paletted image
+ */
+func recorder_paletted(img *image.RGBA) *image.Paletted {
+	var pal color.Palette
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+		if !seen[c] {
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+
+	if len(pal) > 256 {
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+		return paletted
+	}
+
+	paletted := image.NewPaletted(img.Bounds(), pal)
+	draw.Draw(paletted, img.Bounds(), img, image.Point{}, draw.Src)
+	return paletted
+}
@@ -0,0 +1,128 @@
+package rpiws2811
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+/**
+ * Record frames of a simulated strand of two LEDs, advancing the clock
+ * between renders.
+ *
+ * @param    t        test.
+ * @param    colors   colors of the LEDs of each frame.
+ * @param    gaps     time between each frame and the next.
+ * @param    layouts  layout of each frame, nil to keep the default.
+ *
+ * @returns  the recorder
+ */
+func record_frames(t *testing.T, colors [][]uint32, gaps []time.Duration, layouts []Layout) *Recorder {
+	t.Helper()
+
+	rec := &Recorder{Scale: 2}
+	clock := NewFakeClock(time.Unix(0, 0))
+	c1, err := NewLEDStrandChannel(18, 2, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+		WithSimulator(rec),
+		WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewLEDStrand: %v", err)
+	}
+	defer strand.Close()
+
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range colors {
+		if err := channel.CopyFrom(colors[i]); err != nil {
+			t.Fatal(err)
+		}
+		if layouts != nil {
+			channel.SetLayout(layouts[i])
+		}
+		if err := strand.Render(); err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		if i < len(gaps) {
+			clock.Advance(gaps[i])
+		}
+	}
+	return rec
+}
+
+func TestRecorderWritePNG(t *testing.T) {
+	colors := [][]uint32{
+		{0x00ff0000, 0x0000ff00},
+		{0x000000ff, 0x00000000},
+		{0x00102030, 0x00ffffff},
+	}
+	rec := record_frames(t, colors, nil, nil)
+
+	var buf bytes.Buffer
+	if err := rec.WritePNG(&buf, 0); err != nil {
+		t.Fatalf("WritePNG: %v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One row per frame and one column per LED, 2 by 2 pixels each
+	if size := img.Bounds().Size(); size.X != 4 || size.Y != 6 {
+		t.Fatalf("waterfall is %vx%v, want 4x6", size.X, size.Y)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 4; x++ {
+			led := colors[y/2][x/2]
+			want := color.RGBA{R: uint8(led >> 16), G: uint8(led >> 8), B: uint8(led), A: 0xff}
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != want {
+				t.Errorf("pixel %v,%v is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestRecorderWriteGIF(t *testing.T) {
+	colors := [][]uint32{
+		{0x00ff0000, 0x0000ff00},
+		{0x000000ff, 0x00000000},
+		{0x00102030, 0x00ffffff},
+	}
+	// The last frame is laid out as a column, taller than the row before
+	layouts := []Layout{{}, {}, {Width: 1}}
+	rec := record_frames(t, colors, []time.Duration{30 * time.Millisecond, 50 * time.Millisecond}, layouts)
+
+	var buf bytes.Buffer
+	if err := rec.WriteGIF(&buf, 0); err != nil {
+		t.Fatalf("WriteGIF: %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if anim.Config.Width != 4 || anim.Config.Height != 4 {
+		t.Errorf("GIF is %vx%v, want 4x4", anim.Config.Width, anim.Config.Height)
+	}
+	// The last frame lasts as long as the one before
+	want := []int{3, 5, 5}
+	if len(anim.Delay) != len(want) {
+		t.Fatalf("%v frames, want %v", len(anim.Delay), len(want))
+	}
+	for i := range want {
+		if anim.Delay[i] != want[i] {
+			t.Errorf("frame %v lasts %v/100s, want %v/100s", i, anim.Delay[i], want[i])
+		}
+	}
+	if size := anim.Image[2].Bounds().Size(); size.X != 2 || size.Y != 4 {
+		t.Errorf("last frame is %vx%v, want 2x4", size.X, size.Y)
+	}
+}
@@ -2,8 +2,6 @@ package rpiws2811
 
 import (
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 	"regexp"
 	"strconv"
@@ -15,14 +13,24 @@ const (
 	RPI_HWVER_TYPE_UNKNOWN = 0
 	RPI_HWVER_TYPE_PI1     = 1
 	RPI_HWVER_TYPE_PI2     = 2
+	RPI_HWVER_TYPE_PI4     = 3
+
+	// Processors of new-style revision codes
+	RPI_SOC_BCM2835 = 0
+	RPI_SOC_BCM2836 = 1
+	RPI_SOC_BCM2837 = 2
+	RPI_SOC_BCM2711 = 3
+	RPI_SOC_BCM2712 = 4
 )
 
 type rpi_hw_t struct {
 	typeNum        uint32
 	hwver          uint32
+	soc            uint32 // RPI_SOC_xxx
 	periph_base    uint32
 	videocore_base uint32
 	desc           string
+	mismatch       error // How the device tree disagrees with the revision code
 }
 
 // **** </rpihw.h> ****
@@ -31,17 +39,82 @@ type rpi_hw_t struct {
 const (
 	LINE_WIDTH_MAX = 80
 	HW_VER_STRING  = "Revision"
+	PROC_CPUINFO   = "/proc/cpuinfo"
 
 	PERIPH_BASE_RPI  = 0x20000000
 	PERIPH_BASE_RPI2 = 0x3f000000
+	PERIPH_BASE_RPI4 = 0xfe000000
 
 	VIDEOCORE_BASE_RPI  = 0x40000000
 	VIDEOCORE_BASE_RPI2 = 0xc0000000
+	VIDEOCORE_BASE_RPI4 = 0xc0000000 // The direct uncached alias, as on the Pi 2 and 3
 
 	RPI_MANUFACTURER_MASK = (0xf << 16)
 	RPI_WARRANTY_MASK     = (0x3 << 24)
+
+	// Fields of new-style revision codes
+	RPI_REV_NEW_FLAG           = (1 << 23)
+	RPI_REV_MEMORY_SHIFT       = 20
+	RPI_REV_MANUFACTURER_SHIFT = 16
+	RPI_REV_PROCESSOR_SHIFT    = 12
+	RPI_REV_TYPE_SHIFT         = 4
+	RPI_REV_REVISION_MASK      = 0xf
 )
 
+var rpi_soc_names = map[uint32]string{
+	RPI_SOC_BCM2835: "BCM2835",
+	RPI_SOC_BCM2836: "BCM2836",
+	RPI_SOC_BCM2837: "BCM2837",
+	RPI_SOC_BCM2711: "BCM2711",
+	RPI_SOC_BCM2712: "BCM2712",
+}
+
+// Board types of new-style revision codes
+var rpi_board_names = map[uint32]string{
+	0x00: "Model A",
+	0x01: "Model B",
+	0x02: "Model A+",
+	0x03: "Model B+",
+	0x04: "Pi 2 Model B",
+	0x05: "Alpha",
+	0x06: "Compute Module 1",
+	0x08: "Pi 3 Model B",
+	0x09: "Pi Zero",
+	0x0a: "Compute Module 3",
+	0x0c: "Pi Zero W",
+	0x0d: "Pi 3 Model B+",
+	0x0e: "Pi 3 Model A+",
+	0x10: "Compute Module 3+",
+	0x11: "Pi 4 Model B",
+	0x12: "Pi Zero 2 W",
+	0x13: "Pi 400",
+	0x14: "Compute Module 4",
+	0x15: "Compute Module 4S",
+	0x17: "Pi 5",
+	0x18: "Compute Module 5",
+	0x19: "Pi 500",
+	0x1a: "Compute Module 5 Lite",
+}
+
+var rpi_memory_sizes = map[uint32]string{
+	0: "256MB",
+	1: "512MB",
+	2: "1GB",
+	3: "2GB",
+	4: "4GB",
+	5: "8GB",
+	6: "16GB",
+}
+
+var rpi_manufacturer_names = map[uint32]string{
+	0: "Sony UK",
+	1: "Egoman",
+	2: "Embest",
+	3: "Sony Japan",
+	4: "Embest",
+	5: "Stadium",
+}
+
 var rpi_hw_info = []rpi_hw_t{
 	//
 	// Model B Rev 1.0
@@ -140,12 +213,6 @@ var rpi_hw_info = []rpi_hw_t{
 		periph_base:    PERIPH_BASE_RPI,
 		videocore_base: VIDEOCORE_BASE_RPI,
 		desc:           "Model B+"},
-	rpi_hw_t{
-		hwver:          0x900032,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Model B+"},
 
 	//
 	// Compute Module
@@ -163,40 +230,6 @@ var rpi_hw_info = []rpi_hw_t{
 		videocore_base: VIDEOCORE_BASE_RPI,
 		desc:           "Compute Module 1"},
 
-	//
-	// Pi Zero
-	//
-	rpi_hw_t{
-		hwver:          0x900092,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Pi Zero v1.2"},
-	rpi_hw_t{
-		hwver:          0x900093,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Pi Zero v1.3"},
-	rpi_hw_t{
-		hwver:          0x920093,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Pi Zero v1.3"},
-	rpi_hw_t{
-		hwver:          0x9200c1,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Pi Zero W v1.1"},
-	rpi_hw_t{
-		hwver:          0x9000c1,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Pi Zero W v1.1"},
-
 	//
 	// Model A+
 	//
@@ -212,107 +245,110 @@ var rpi_hw_info = []rpi_hw_t{
 		periph_base:    PERIPH_BASE_RPI,
 		videocore_base: VIDEOCORE_BASE_RPI,
 		desc:           "Model A+"},
-	rpi_hw_t{
-		hwver:          0x900021,
-		typeNum:        RPI_HWVER_TYPE_PI1,
-		periph_base:    PERIPH_BASE_RPI,
-		videocore_base: VIDEOCORE_BASE_RPI,
-		desc:           "Model A+"},
-
-	//
-	// Pi 2 Model B
-	//
-	rpi_hw_t{
-		hwver:          0xa01041,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 2"},
-	rpi_hw_t{
-		hwver:          0xa01040,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 2"},
-	rpi_hw_t{
-		hwver:          0xa21041,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 2"},
-	//
-	// Pi 2 with BCM2837
-	//
-	rpi_hw_t{
-		hwver:          0xa22042,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 2"},
-	//
-	// Pi 3 Model B
-	//
-	rpi_hw_t{
-		hwver:          0xa02082,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 3"},
-	rpi_hw_t{
-		hwver:          0xa22082,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Pi 3"},
-	//
-	// Pi Compute Module 3
-	//
-	rpi_hw_t{
-		hwver:          0xa020a0,
-		typeNum:        RPI_HWVER_TYPE_PI2,
-		periph_base:    PERIPH_BASE_RPI2,
-		videocore_base: VIDEOCORE_BASE_RPI2,
-		desc:           "Compute Module 3/L3"},
 }
 
-func rpi_hw_detect() (*rpi_hw_t, error) {
-	cpuInfoPath := "/proc/cpuinfo"
-	file, err := os.OpenFile(cpuInfoPath, os.O_RDONLY, 0)
-	defer file.Close()
-	if err != nil {
-		log.Printf("Can't open %v", cpuInfoPath)
-		return nil, err
-	}
-	b, err := ioutil.ReadAll(file)
+var rpi_revision_regex = regexp.MustCompile(`(?m)^Revision\s*:\s*([0-9a-fA-F]+)\s*$`)
+
+/**
+ * Detect the board from the revision code in cpuinfo.
+ *
+ * @param    cpuinfo_path  path of cpuinfo, normally /proc/cpuinfo.
+ *
+ * @returns  the board on success, error if it can't be read or isn't supported
+ */
+func rpi_hw_detect(cpuinfo_path string) (*rpi_hw_t, error) {
+	b, err := os.ReadFile(cpuinfo_path)
 	if err != nil {
-		log.Printf("Can't read all from %v", cpuInfoPath)
-		return nil, err
+		return nil, ws2811_error(WS2811_ERROR_HW_NOT_SUPPORTED, "rpi_hw_detect", err)
 	}
-	regex := regexp.MustCompile(`Revision.*: (.*)`)
 
-	//all := regex.FindSubmatch([]byte("Revision  : 1ab246"))
-	all := regex.FindSubmatch(b)
+	all := rpi_revision_regex.FindSubmatch(b)
 	if len(all) < 2 {
-		err = fmt.Errorf("Can't find revsion number %v", cpuInfoPath)
-		return nil, err
+		return nil, ws2811_errorf(WS2811_ERROR_HW_NOT_SUPPORTED, "rpi_hw_detect", "can't find revision number in %v", cpuinfo_path)
 	}
-	revString := all[1]
-	rev, err := strconv.ParseInt(string(revString), 0, 64)
+	rev, err := strconv.ParseUint(string(all[1]), 16, 32)
 	if err != nil {
-		log.Printf("Can't parse int from %s", revString)
-		return nil, err
+		return nil, ws2811_error(WS2811_ERROR_HW_NOT_SUPPORTED, "rpi_hw_detect", err)
 	}
 
-	for _, rpi := range rpi_hw_info {
-		hwver := rpi.hwver
+	return rpi_hw_from_revision(uint32(rev))
+}
 
-		// Take out warranty and manufacturer bits
-		hwver = ^(^hwver | (RPI_WARRANTY_MASK | RPI_MANUFACTURER_MASK))
-		rev = ^(^rev | (RPI_WARRANTY_MASK | RPI_MANUFACTURER_MASK))
+/**
+ * Describe the board of a revision code, decoding new-style codes and looking
+ * up old-style ones in rpi_hw_info.
+ *
+ * @param    rev  revision code.
+ *
+ * @returns  the board on success, error if it isn't known or supported
+ */
+func rpi_hw_from_revision(rev uint32) (*rpi_hw_t, error) {
+	if (rev & RPI_REV_NEW_FLAG) != 0 {
+		return rpi_hw_decode(rev)
+	}
 
-		if uint32(rev) == hwver {
+	// Take out warranty and manufacturer bits
+	hwver := rev &^ (RPI_WARRANTY_MASK | RPI_MANUFACTURER_MASK)
+	for _, rpi := range rpi_hw_info {
+		if rpi.hwver == hwver {
+			rpi.hwver = rev
 			return &rpi, nil
 		}
 	}
-	return nil, fmt.Errorf("couldn't find matching revision for %v in rpi_hw_info", rev)
+	return nil, ws2811_errorf(WS2811_ERROR_HW_NOT_SUPPORTED, "rpi_hw_from_revision", "couldn't find matching revision for %#x in rpi_hw_info", rev)
+}
+
+/**
+ * Decode a new-style revision code, laid out as NOQuuuWuFMMMCCCCPPPPTTTTTTTTRRRR:
+ * new flag N, memory size M, manufacturer C, processor P, board type T and
+ * board revision R.
+ *
+ * @param    rev  revision code with the new flag set.
+ *
+ * @returns  the board on success, error if its processor isn't supported
+ */
+func rpi_hw_decode(rev uint32) (*rpi_hw_t, error) {
+	soc := (rev >> RPI_REV_PROCESSOR_SHIFT) & 0xf
+	board := (rev >> RPI_REV_TYPE_SHIFT) & 0xff
+	memory := (rev >> RPI_REV_MEMORY_SHIFT) & 0x7
+	manufacturer := (rev >> RPI_REV_MANUFACTURER_SHIFT) & 0xf
+
+	model, ok := rpi_board_names[board]
+	if !ok {
+		model = fmt.Sprintf("unknown board %#x", board)
+	}
+	desc := fmt.Sprintf("%v Rev 1.%d", model, rev&RPI_REV_REVISION_MASK)
+	if size, ok := rpi_memory_sizes[memory]; ok {
+		desc += ", " + size
+	}
+	if name, ok := rpi_manufacturer_names[manufacturer]; ok {
+		desc += ", " + name
+	}
+
+	rpi := &rpi_hw_t{
+		hwver: rev,
+		soc:   soc,
+		desc:  desc,
+	}
+	switch soc {
+	case RPI_SOC_BCM2835:
+		rpi.typeNum = RPI_HWVER_TYPE_PI1
+		rpi.periph_base = PERIPH_BASE_RPI
+		rpi.videocore_base = VIDEOCORE_BASE_RPI
+	case RPI_SOC_BCM2836, RPI_SOC_BCM2837:
+		rpi.typeNum = RPI_HWVER_TYPE_PI2
+		rpi.periph_base = PERIPH_BASE_RPI2
+		rpi.videocore_base = VIDEOCORE_BASE_RPI2
+	case RPI_SOC_BCM2711:
+		rpi.typeNum = RPI_HWVER_TYPE_PI4
+		rpi.periph_base = PERIPH_BASE_RPI4
+		rpi.videocore_base = VIDEOCORE_BASE_RPI4
+	default:
+		soc_name, ok := rpi_soc_names[soc]
+		if !ok {
+			soc_name = fmt.Sprintf("processor %#x", soc)
+		}
+		return nil, ws2811_errorf(WS2811_ERROR_HW_NOT_SUPPORTED, "rpi_hw_decode", "%v (revision %#x) has a %v, which isn't supported", desc, rev, soc_name)
+	}
+	return rpi, nil
 }
@@ -0,0 +1,90 @@
+package rpiws2811
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRPiHWDetect(t *testing.T) {
+	tests := []struct {
+		cpuinfo     string
+		periph_base uint32
+		vc_base     uint32
+		desc        string
+	}{
+		{"pi3b", PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "Pi 3 Model B Rev 1.2, 1GB, Sony UK"},
+		{"pi3bplus", PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "Pi 3 Model B+ Rev 1.3, 1GB, Sony UK"},
+		{"pizerow", PERIPH_BASE_RPI, VIDEOCORE_BASE_RPI, "Pi Zero W Rev 1.1, 512MB, Sony UK"},
+		{"pizero2w", PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "Pi Zero 2 W Rev 1.0, 512MB, Sony UK"},
+		{"pi4b", PERIPH_BASE_RPI4, VIDEOCORE_BASE_RPI4, "Pi 4 Model B Rev 1.1, 4GB, Sony UK"},
+		{"pi4b-8gb", PERIPH_BASE_RPI4, VIDEOCORE_BASE_RPI4, "Pi 4 Model B Rev 1.4, 8GB, Sony UK"},
+		{"cm4", PERIPH_BASE_RPI4, VIDEOCORE_BASE_RPI4, "Compute Module 4 Rev 1.0, 1GB, Sony UK"},
+		{"pi1b", PERIPH_BASE_RPI, VIDEOCORE_BASE_RPI, "Model B"},
+		// The warranty bits are ignored
+		{"pi1b-warranty", PERIPH_BASE_RPI, VIDEOCORE_BASE_RPI, "Model B"},
+		{"pi3b-warranty", PERIPH_BASE_RPI2, VIDEOCORE_BASE_RPI2, "Pi 3 Model B Rev 1.2, 1GB, Sony UK"},
+	}
+
+	for _, test := range tests {
+		rpi_hw, err := rpi_hw_detect(filepath.Join("testdata", "cpuinfo", test.cpuinfo))
+		if err != nil {
+			t.Errorf("%v: %v", test.cpuinfo, err)
+			continue
+		}
+		if rpi_hw.periph_base != test.periph_base || rpi_hw.videocore_base != test.vc_base || rpi_hw.desc != test.desc {
+			t.Errorf("%v: %#x, %#x, %q, want %#x, %#x, %q", test.cpuinfo,
+				rpi_hw.periph_base, rpi_hw.videocore_base, rpi_hw.desc, test.periph_base, test.vc_base, test.desc)
+		}
+	}
+}
+
+func TestRPiHWDetectUnsupported(t *testing.T) {
+	for _, cpuinfo := range []string{"pi5", "no-revision", "missing"} {
+		_, err := rpi_hw_detect(filepath.Join("testdata", "cpuinfo", cpuinfo))
+		if !errors.Is(err, ErrHWNotSupported) {
+			t.Errorf("%v: error %v, want ErrHWNotSupported", cpuinfo, err)
+		}
+	}
+}
+
+func TestRPiHWDetectLegacy(t *testing.T) {
+	models := map[uint32]string{
+		0x02: "Model B", 0x03: "Model B", 0x04: "Model B", 0x05: "Model B", 0x06: "Model B",
+		0x07: "Model A", 0x08: "Model A", 0x09: "Model A",
+		0x0d: "Model B", 0x0e: "Model B", 0x0f: "Model B",
+		0x10: "Model B+", 0x13: "Model B+",
+		0x11: "Compute Module 1", 0x14: "Compute Module 1",
+		0x12: "Model A+", 0x15: "Model A+",
+	}
+
+	dir := t.TempDir()
+	for rev := uint32(0x2); rev <= 0x15; rev++ {
+		// Boards made by others than Sony UK carry the manufacturer as well
+		for _, code := range []uint32{rev, rev | RPI_WARRANTY_MASK, rev | (2 << RPI_REV_MANUFACTURER_SHIFT)} {
+			path := filepath.Join(dir, fmt.Sprintf("cpuinfo-%x", code))
+			if err := os.WriteFile(path, []byte(fmt.Sprintf("Hardware\t: BCM2835\nRevision\t: %04x\n", code)), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			rpi_hw, err := rpi_hw_detect(path)
+			desc, ok := models[rev]
+			if !ok {
+				if !errors.Is(err, ErrHWNotSupported) {
+					t.Errorf("%#x: error %v, want ErrHWNotSupported", code, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%#x: %v", code, err)
+				continue
+			}
+			if rpi_hw.periph_base != PERIPH_BASE_RPI || rpi_hw.videocore_base != VIDEOCORE_BASE_RPI || rpi_hw.desc != desc || rpi_hw.hwver != code {
+				t.Errorf("%#x: %#x, %#x, %q, revision %#x, want %#x, %#x, %q", code,
+					rpi_hw.periph_base, rpi_hw.videocore_base, rpi_hw.desc, rpi_hw.hwver, PERIPH_BASE_RPI, VIDEOCORE_BASE_RPI, desc)
+			}
+		}
+	}
+}
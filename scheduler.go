@@ -0,0 +1,174 @@
+package rpiws2811
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// OverrunPolicy is what a Scheduler does when a frame took so long the next
+// one is already due.
+type OverrunPolicy int
+
+const (
+	// OverrunDrop skips the frames whose time has passed and renders the
+	// latest one due at once, keeping the animation in time.
+	OverrunDrop OverrunPolicy = iota
+	// OverrunCatchUp renders every late frame back to back until the
+	// schedule is caught up, so no frame is lost.
+	OverrunCatchUp
+)
+
+// SchedulerStats describes how well a Scheduler kept to its schedule.
+// Jitter is how late a frame starts after it was due.
+type SchedulerStats struct {
+	Frames   int // Frames started
+	Overruns int // Frames found late because the previous one overran
+	Dropped  int // Frames skipped by OverrunDrop
+
+	MeanJitter   time.Duration
+	StdDevJitter time.Duration
+	MaxJitter    time.Duration
+}
+
+func (stats SchedulerStats) String() string {
+	return fmt.Sprintf("%d frames, %d overruns, %d dropped, jitter mean %v stddev %v max %v",
+		stats.Frames, stats.Overruns, stats.Dropped, stats.MeanJitter, stats.StdDevJitter, stats.MaxJitter)
+}
+
+// Scheduler paces frames at FPS frames per second. Frame i is due at the time
+// the first one started plus i periods, so the frame rate doesn't drift with
+// how long the frames take, and Overrun decides what happens to the frames
+// due while one overran.
+//
+// A Scheduler is used by a single loop at a time, either its own Run or the
+// one of a strand given WithScheduler. Stats may be called from anywhere.
+type Scheduler struct {
+	FPS     float64       // Target frame rate
+	Overrun OverrunPolicy // What happens to late frames
+	Clock   Clock         // Defaults to SystemClock
+
+	mu      sync.Mutex
+	started bool
+	next    time.Time // When the next frame is due
+	stats   SchedulerStats
+	mean    float64 // Running mean and sum of squared deviations of the jitter, in ns
+	m2      float64
+}
+
+// Run calls render for every frame, passing it when the frame was due, until
+// ctx is done or render fails.
+func (sched *Scheduler) Run(ctx context.Context, render func(due time.Time) error) error {
+	for {
+		due, err := sched.Wait(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := render(due); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait sleeps until the next frame is due and returns when it was due. The
+// first frame is due at once. It fails if FPS isn't positive or ctx is done.
+func (sched *Scheduler) Wait(ctx context.Context) (time.Time, error) {
+	if sched.FPS <= 0 || math.IsInf(sched.FPS, 0) || math.IsNaN(sched.FPS) {
+		return time.Time{}, fmt.Errorf("invalid frame rate %v", sched.FPS)
+	}
+	period := time.Duration(float64(time.Second) / sched.FPS)
+	if period <= 0 {
+		period = 1
+	}
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	clock := sched.clock()
+	now := clock.Now()
+
+	sched.mu.Lock()
+	if !sched.started {
+		sched.started = true
+		sched.next = now
+	}
+	if late := now.Sub(sched.next); late > 0 {
+		sched.stats.Overruns++
+		if sched.Overrun == OverrunDrop && late >= period {
+			skip := int(late / period)
+			sched.next = sched.next.Add(time.Duration(skip) * period)
+			sched.stats.Dropped += skip
+		}
+	}
+	due := sched.next
+	sched.next = due.Add(period)
+	sched.mu.Unlock()
+
+	if wait := due.Sub(now); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return time.Time{}, ctx.Err()
+		case <-clock.After(wait):
+		}
+	}
+
+	sched.record(clock.Now().Sub(due))
+	return due, nil
+}
+
+// Stats returns the statistics of the frames started so far.
+func (sched *Scheduler) Stats() SchedulerStats {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	stats := sched.stats
+	stats.MeanJitter = time.Duration(sched.mean)
+	if stats.Frames > 1 {
+		stats.StdDevJitter = time.Duration(math.Sqrt(sched.m2 / float64(stats.Frames-1)))
+	}
+	return stats
+}
+
+// Reset forgets the statistics, and starts the schedule over at the next frame.
+func (sched *Scheduler) Reset() {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	sched.started = false
+	sched.stats = SchedulerStats{}
+	sched.mean = 0
+	sched.m2 = 0
+}
+
+func (sched *Scheduler) clock() Clock {
+	if sched.Clock == nil {
+		return SystemClock{}
+	}
+	return sched.Clock
+}
+
+/**
+ * Account for the start of a frame, with Welford's running variance.
+ *
+ * @param    jitter  how late the frame started.
+ *
+ * @returns  None
+ */
+func (sched *Scheduler) record(jitter time.Duration) {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	sched.stats.Frames++
+	if jitter > sched.stats.MaxJitter {
+		sched.stats.MaxJitter = jitter
+	}
+
+	delta := float64(jitter) - sched.mean
+	sched.mean += delta / float64(sched.stats.Frames)
+	sched.m2 += delta * (float64(jitter) - sched.mean)
+}
@@ -0,0 +1,60 @@
+package rpiws2811
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerOverrun(t *testing.T) {
+	tests := []struct {
+		policy OverrunPolicy
+		want   SchedulerStats
+	}{
+		// Frame 2 takes 35ms of a 10ms period: the frames due at 30 and 40ms
+		// are dropped and the one due at 50ms starts 5ms late, at 55ms
+		{OverrunDrop, SchedulerStats{Frames: 10, Overruns: 1, Dropped: 2, MaxJitter: 5 * time.Millisecond}},
+		// The frames due at 30, 40 and 50ms start 1ms apart from 55ms
+		{OverrunCatchUp, SchedulerStats{Frames: 10, Overruns: 3, Dropped: 0, MaxJitter: 25 * time.Millisecond}},
+	}
+
+	for _, test := range tests {
+		clock := NewFakeClock(time.Unix(0, 0))
+		sched := &Scheduler{FPS: 100, Overrun: test.policy, Clock: clock}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var dues []time.Duration
+		err := sched.Run(ctx, func(due time.Time) error {
+			dues = append(dues, due.Sub(time.Unix(0, 0)))
+			if len(dues) == 3 {
+				clock.Advance(35 * time.Millisecond)
+			} else {
+				clock.Advance(time.Millisecond)
+			}
+			if len(dues) == 10 {
+				cancel()
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("policy %v: Run: %v", test.policy, err)
+		}
+
+		stats := sched.Stats()
+		if stats.Frames != test.want.Frames || stats.Overruns != test.want.Overruns || stats.Dropped != test.want.Dropped {
+			t.Errorf("policy %v: %v frames, %v overruns, %v dropped, want %v, %v, %v", test.policy,
+				stats.Frames, stats.Overruns, stats.Dropped, test.want.Frames, test.want.Overruns, test.want.Dropped)
+		}
+		if stats.MaxJitter != test.want.MaxJitter {
+			t.Errorf("policy %v: max jitter %v, want %v", test.policy, stats.MaxJitter, test.want.MaxJitter)
+		}
+
+		// Frames stay on the 10ms grid whatever happened to them
+		for i, due := range dues {
+			if due%(10*time.Millisecond) != 0 {
+				t.Errorf("policy %v: frame %v due at %v, off the schedule", test.policy, i, due)
+			}
+		}
+	}
+}
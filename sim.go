@@ -0,0 +1,35 @@
+package rpiws2811
+
+// The simulated board, a Pi 3 with the 40 pin header.
+var sim_rpi_hw = rpi_hw_t{
+	hwver:          0xa02082,
+	typeNum:        RPI_HWVER_TYPE_PI2,
+	periph_base:    PERIPH_BASE_RPI2,
+	videocore_base: VIDEOCORE_BASE_RPI2,
+	desc:           "Simulator",
+}
+
+/**
+ * Allocate the LED buffers and a DMA buffer in plain memory, for a strand
+ * which sends its frames to its frame sinks instead of to the hardware.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  None
+ */
+func sim_init(strand *LEDStrand) {
+	device := strand.device
+
+	for i := range strand.channel {
+		ws2811_channel_init(&strand.channel[i])
+	}
+
+	switch device.driver_mode {
+	case PWM:
+		device.pxl_raw = make([]byte, PWM_BYTE_COUNT(device.max_count, strand.freq))
+		pwm_raw_init(strand)
+	case PCM, SPI:
+		device.pxl_raw = make([]byte, PCM_BYTE_COUNT(device.max_count, strand.freq))
+		pcm_raw_init(strand)
+	}
+}
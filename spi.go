@@ -0,0 +1,208 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// **** <linux/spi/spidev.h> ****
+
+const (
+	DEV_SPIDEV = "/dev/spidev0.0"
+
+	SPI_MODE_0 = 0
+
+	// Linux ioctl numbers for spidev, _IOR/_IOW('k', nr, size).
+	// The direction lives in the top two bits (write = 1, read = 2),
+	// which is not the <ioccom.h> layout used by IOCTL_MBOX_PROPERTY.
+	SPI_IOC_RD_MODE          = 0x80016b01
+	SPI_IOC_WR_MODE          = 0x40016b01
+	SPI_IOC_RD_BITS_PER_WORD = 0x80016b03
+	SPI_IOC_WR_BITS_PER_WORD = 0x40016b03
+	SPI_IOC_RD_MAX_SPEED_HZ  = 0x80046b04
+	SPI_IOC_WR_MAX_SPEED_HZ  = 0x40046b04
+)
+
+// **** </linux/spi/spidev.h> ****
+
+type spi_pin_table_t struct {
+	pinnum int
+	altnum int
+	name   string // SPIn_MOSI
+	dev    string // spidev device of the controller
+}
+
+// Mapping of Pin to alternate function for SPI0-MOSI
+var spi_pin_mosi = []spi_pin_table_t{
+	spi_pin_table_t{
+		pinnum: 10,
+		altnum: 0,
+		name:   "SPI0_MOSI",
+		dev:    DEV_SPIDEV},
+	spi_pin_table_t{
+		pinnum: 38,
+		altnum: 0,
+		name:   "SPI0_MOSI",
+		dev:    DEV_SPIDEV},
+}
+
+// Mapping of Pin to alternate function for the MOSI of SPI3 to SPI6 of the
+// BCM2711, enabled by the spi3-1cs to spi6-1cs overlays
+var spi_pin_mosi_bcm2711 = []spi_pin_table_t{
+	spi_pin_table_t{
+		pinnum: 2,
+		altnum: 3,
+		name:   "SPI3_MOSI",
+		dev:    "/dev/spidev3.0"},
+	spi_pin_table_t{
+		pinnum: 6,
+		altnum: 3,
+		name:   "SPI4_MOSI",
+		dev:    "/dev/spidev4.0"},
+	spi_pin_table_t{
+		pinnum: 14,
+		altnum: 3,
+		name:   "SPI5_MOSI",
+		dev:    "/dev/spidev5.0"},
+	spi_pin_table_t{
+		pinnum: 20,
+		altnum: 3,
+		name:   "SPI6_MOSI",
+		dev:    "/dev/spidev6.0"},
+}
+
+/**
+ * Find the SPI controller whose MOSI is on a pin.
+ *
+ * @param    rpi_hw  board.
+ * @param    pinnum  gpio.
+ *
+ * @returns  the pin, ok false if no SPI-MOSI is on it
+ */
+func spi_pin(rpi_hw *rpi_hw_t, pinnum int) (spi_pin_table_t, bool) {
+	pins := spi_pin_mosi
+	if rpi_hw.soc == RPI_SOC_BCM2711 {
+		pins = append(pins[:len(pins):len(pins)], spi_pin_mosi_bcm2711...)
+	}
+
+	for _, pin := range pins {
+		if pin.pinnum == pinnum {
+			return pin, true
+		}
+	}
+	return spi_pin_table_t{}, false
+}
+
+func spi_ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+/**
+ * Open and configure the spidev device, point the SPI-MOSI pin at it and
+ * allocate the transmit buffer.
+ *
+ * Mode, word size and speed are only configured, and the pin only muxed,
+ * when the device is a character device.  Anything else (a plain file or a
+ * fifo) just receives the encoded frames.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error otherwise
+ */
+func spi_init(strand *LEDStrand) error {
+	mode := uint8(SPI_MODE_0)
+	bits := uint8(8)
+	speed := strand.freq * 3
+	device := strand.device
+	base := strand.rpi_hw.periph_base
+	pin, ok := spi_pin(strand.rpi_hw, strand.channel[0].gpionum)
+	if !ok {
+		return ws2811_errorf(WS2811_ERROR_SPI_SETUP, "spi_init", "no SPI-MOSI on gpio %v", strand.channel[0].gpionum)
+	}
+
+	path := strand.spi_dev
+	if path == "" {
+		path = pin.dev
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_SPI_SETUP, "spi_init", fmt.Errorf("spi_bcm2835 module or spi overlay not loaded? %w", err))
+	}
+	device.spi_file = file
+
+	info, err := file.Stat()
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_SPI_SETUP, "spi_init", err)
+	}
+
+	if info.Mode()&os.ModeCharDevice != 0 {
+		settings := []struct {
+			name    string
+			request uintptr
+			arg     unsafe.Pointer
+		}{
+			// SPI mode
+			{"SPI_IOC_WR_MODE", SPI_IOC_WR_MODE, unsafe.Pointer(&mode)},
+			{"SPI_IOC_RD_MODE", SPI_IOC_RD_MODE, unsafe.Pointer(&mode)},
+			// Bits per word
+			{"SPI_IOC_WR_BITS_PER_WORD", SPI_IOC_WR_BITS_PER_WORD, unsafe.Pointer(&bits)},
+			{"SPI_IOC_RD_BITS_PER_WORD", SPI_IOC_RD_BITS_PER_WORD, unsafe.Pointer(&bits)},
+			// Max speed Hz
+			{"SPI_IOC_WR_MAX_SPEED_HZ", SPI_IOC_WR_MAX_SPEED_HZ, unsafe.Pointer(&speed)},
+			{"SPI_IOC_RD_MAX_SPEED_HZ", SPI_IOC_RD_MAX_SPEED_HZ, unsafe.Pointer(&speed)},
+		}
+		for _, setting := range settings {
+			if err := spi_ioctl(file, setting.request, setting.arg); err != nil {
+				return ws2811_error(WS2811_ERROR_SPI_SETUP, "spi_init", fmt.Errorf("%v: %w", setting.name, err))
+			}
+		}
+
+		// Set SPI-MOSI pin, through /dev/gpiomem unless the registers are faked
+		mem := strand.mem
+		if devmem, ok := mem.(DevMem); ok && devmem.Path == DEV_MEM {
+			mem = DevMem{Path: DEV_GPIOMEM}
+		}
+		device.gpio, err = mem.Map(GPIO_OFFSET+base, unsafe.Sizeof(gpio_t{}))
+		if err != nil {
+			return ws2811_error(WS2811_ERROR_SPI_SETUP, "spi_init", err)
+		}
+		gpio_function_set(device.gpio, pin.pinnum, pin.altnum) // SPI-MOSI
+	}
+
+	// Allocate LED buffer
+	ws2811_channel_init(&strand.channel[0])
+
+	// Allocate SPI transmit buffer (same size as PCM)
+	device.pxl_raw = make([]byte, PCM_BYTE_COUNT(device.max_count, strand.freq))
+	pcm_raw_init(strand)
+
+	return nil
+}
+
+/**
+ * Send the encoded frame to the spidev device.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error otherwise
+ */
+func spi_transfer(strand *LEDStrand) error {
+	device := strand.device
+	length := PCM_BYTE_COUNT(device.max_count, strand.freq)
+
+	n, err := device.spi_file.Write(device.pxl_raw[:length])
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_SPI_TRANSFER, "spi_transfer", err)
+	}
+	if n != int(length) {
+		return ws2811_errorf(WS2811_ERROR_SPI_TRANSFER, "spi_transfer", "wrote %v of %v bytes", n, length)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package rpiws2811
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSPIRender(t *testing.T) {
+	colors := []uint32{0x00ff8001, 0x0000ff00}
+
+	for _, invert := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "spidev")
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		c1, err := NewLEDStrandChannel(10, len(colors), 255, invert, WS2811_STRIP_GRB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+			WithCPUInfo("testdata/cpuinfo/pi3b"),
+			WithDeviceTree(""),
+			WithSPIDevice(path))
+		if err != nil {
+			t.Fatalf("invert %v: NewLEDStrand: %v", invert, err)
+		}
+		if mode := strand.Waveform().DriverMode; mode != SPI {
+			t.Errorf("invert %v: driver mode %v, want SPI", invert, mode)
+		}
+
+		channel, err := strand.Channel(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.CopyFrom(colors); err != nil {
+			t.Fatal(err)
+		}
+		if err := strand.Render(); err != nil {
+			t.Fatalf("invert %v: Render: %v", invert, err)
+		}
+		waveform := strand.Waveform()
+		if err := strand.Close(); err != nil {
+			t.Fatalf("invert %v: Close: %v", invert, err)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int(PCM_BYTE_COUNT(len(colors), WS2811_TARGET_FREQ)); len(raw) != want {
+			t.Errorf("invert %v: wrote %v bytes, want %v", invert, len(raw), want)
+		}
+
+		leds, err := waveform.Decode(raw)
+		if err != nil {
+			t.Fatalf("invert %v: Decode: %v", invert, err)
+		}
+		if len(leds[0]) != len(colors) {
+			t.Fatalf("invert %v: decoded %v LEDs, want %v", invert, len(leds[0]), len(colors))
+		}
+		for i := range colors {
+			if leds[0][i] != colors[i] {
+				t.Errorf("invert %v: LED %v is %08x, want %08x", invert, i, leds[0][i], colors[i])
+			}
+		}
+	}
+}
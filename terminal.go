@@ -0,0 +1,100 @@
+package rpiws2811
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Terminal is a FrameSink drawing every frame on a terminal with 24-bit ANSI
+// colors, each LED as a block laid out as its channel's Layout. Every frame is
+// drawn over the previous one.
+//
+// The colors are decoded from the encoded frame, so they show brightness and
+// gamma. By default the strips take the colors in the order of the LEDType of
+// their channel; SetStripType makes them take them in another order, to see
+// what a strip wired differently shows.
+type Terminal struct {
+	mu         sync.Mutex
+	out        io.Writer
+	strip_type [RPI_PWM_CHANNELS]LEDType // Color layout of the simulated strips, 0 if as configured
+	lines      int                       // Lines drawn by the previous frame
+}
+
+var _ FrameSink = (*Terminal)(nil)
+
+// NewTerminal returns a Terminal drawing on out, usually os.Stdout.
+func NewTerminal(out io.Writer) *Terminal {
+	return &Terminal{
+		out: out,
+	}
+}
+
+// SetStripType sets the color layout the LEDs of channel actually take their
+// colors in, 0 for the LEDType the channel was created with.
+func (term *Terminal) SetStripType(channel int, stripType LEDType) error {
+	term.mu.Lock()
+	defer term.mu.Unlock()
+
+	if channel < 0 || channel >= len(term.strip_type) {
+		return fmt.Errorf("%w: channel %v not in [0, %v)", ErrOutOfRange, channel, len(term.strip_type))
+	}
+	term.strip_type[channel] = stripType
+	return nil
+}
+
+// Frame draws frame over the previous one.
+func (term *Terminal) Frame(frame Frame) error {
+	term.mu.Lock()
+	defer term.mu.Unlock()
+
+	waveform := frame.Waveform
+	for i, strip_type := range term.strip_type {
+		if strip_type != 0 {
+			waveform.StripType[i] = strip_type
+		}
+	}
+	leds, err := waveform.Decode(frame.Raw)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if term.lines > 0 {
+		// Back to the top of the previous frame
+		fmt.Fprintf(&buf, "\x1b[%dA", term.lines)
+	}
+
+	lines := 0
+	for channum, channel := range leds {
+		if len(channel) == 0 {
+			continue
+		}
+
+		layout := frame.Layout[channum]
+		width, height := layout.Size(len(channel))
+		grid := make([][]uint32, height)
+		for y := range grid {
+			grid[y] = make([]uint32, width)
+		}
+		for i, led := range channel {
+			x, y := layout.Position(i)
+			grid[y][x] = led
+		}
+
+		for _, row := range grid {
+			buf.WriteString("\r")
+			for _, led := range row {
+				r, g, b := led_rgb(led)
+				fmt.Fprintf(&buf, "\x1b[38;2;%d;%d;%dm██", r, g, b)
+			}
+			buf.WriteString("\x1b[0m\x1b[K\n")
+			lines++
+		}
+	}
+	term.lines = lines
+
+	_, err = term.out.Write(buf.Bytes())
+	return err
+}
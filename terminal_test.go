@@ -0,0 +1,60 @@
+package rpiws2811
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTerminal(t *testing.T) {
+	var out bytes.Buffer
+	term := NewTerminal(&out)
+
+	c1, err := NewLEDStrandChannel(18, 2, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, false, c1, LEDStrandChannel{},
+		WithSimulator(term),
+		WithClock(NewFakeClock(time.Unix(0, 0))))
+	if err != nil {
+		t.Fatalf("NewLEDStrand: %v", err)
+	}
+	defer strand.Close()
+
+	channel, err := strand.Channel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := channel.CopyFrom([]uint32{0x00ff0000, 0x000000ff}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "\r\x1b[38;2;255;0;0m██\x1b[38;2;0;0;255m██\x1b[0m\x1b[K\n"
+	if got := out.String(); got != want {
+		t.Errorf("first frame %q, want %q", got, want)
+	}
+
+	// A strip taking RGB shows the green sent first of GRB as red, and the red as green
+	if err := term.SetStripType(0, WS2811_STRIP_RGB); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want = "\x1b[1A\r\x1b[38;2;0;255;0m██\x1b[38;2;0;0;255m██\x1b[0m\x1b[K\n"
+	if got := out.String(); got != want {
+		t.Errorf("frame as RGB %q, want %q", got, want)
+	}
+
+	for _, channum := range []int{-1, RPI_PWM_CHANNELS} {
+		if err := term.SetStripType(channum, WS2811_STRIP_RGB); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("SetStripType(%v): error %v, want ErrOutOfRange", channum, err)
+		}
+	}
+}
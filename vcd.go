@@ -0,0 +1,118 @@
+package rpiws2811
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// WriteVCD writes the signal a DMA buffer puts on the wire as an IEEE 1364
+// Value Change Dump, to check its timing with GTKWave or in tests.
+//
+// There is one signal per channel, after the inversion PWM does in hardware,
+// and one bit lasts as long as with the clock divider programmed for Freq
+// from OscFreq. Times are in picoseconds. Buffers which can't come from the
+// driver mode are rejected with ErrMalformedWaveform, as by Decode.
+func (waveform Waveform) WriteVCD(w io.Writer, raw []byte) error {
+	channels := 1
+	switch waveform.DriverMode {
+	case PWM:
+		channels = RPI_PWM_CHANNELS
+		if len(raw)%8 != 0 {
+			return fmt.Errorf("%w: %v bytes is not a whole number of PWM word pairs", ErrMalformedWaveform, len(raw))
+		}
+	case PCM:
+		if len(raw)%4 != 0 {
+			return fmt.Errorf("%w: %v bytes is not a whole number of PCM words", ErrMalformedWaveform, len(raw))
+		}
+	case SPI:
+	default:
+		return fmt.Errorf("%w: unknown driver mode %v", ErrMalformedWaveform, waveform.DriverMode)
+	}
+	if waveform.Freq == 0 {
+		return fmt.Errorf("%w: no frequency", ErrMalformedWaveform)
+	}
+
+	var signals [RPI_PWM_CHANNELS][]bool
+	for channum := 0; channum < channels; channum++ {
+		signals[channum] = waveform_bits(raw, waveform.DriverMode, channum)
+		if waveform.DriverMode == PWM && waveform.Invert[channum] {
+			for i := range signals[channum] {
+				signals[channum][i] = !signals[channum][i]
+			}
+		}
+	}
+	length := len(signals[0])
+
+	out := bufio.NewWriter(w)
+	ids := [RPI_PWM_CHANNELS]string{"!", "\""}
+
+	fmt.Fprintf(out, "$version rpiws2811 %v at %v Hz $end\n", driver_mode_names[waveform.DriverMode], waveform.Freq)
+	fmt.Fprintf(out, "$timescale 1ps $end\n")
+	fmt.Fprintf(out, "$scope module ws2811 $end\n")
+	for channum := 0; channum < channels; channum++ {
+		fmt.Fprintf(out, "$var wire 1 %v channel%v $end\n", ids[channum], channum)
+	}
+	fmt.Fprintf(out, "$upscope $end\n")
+	fmt.Fprintf(out, "$enddefinitions $end\n")
+
+	var level [RPI_PWM_CHANNELS]bool
+	for i := 0; i < length; i++ {
+		var changes []int
+		for channum := 0; channum < channels; channum++ {
+			if i == 0 || signals[channum][i] != level[channum] {
+				changes = append(changes, channum)
+				level[channum] = signals[channum][i]
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "#%d\n", waveform_bit_time(waveform, i))
+		if i == 0 {
+			fmt.Fprintf(out, "$dumpvars\n")
+		}
+		for _, channum := range changes {
+			value := 0
+			if level[channum] {
+				value = 1
+			}
+			fmt.Fprintf(out, "%d%v\n", value, ids[channum])
+		}
+		if i == 0 {
+			fmt.Fprintf(out, "$end\n")
+		}
+	}
+	// Mark the end of the last bit
+	fmt.Fprintf(out, "#%d\n", waveform_bit_time(waveform, length))
+
+	return out.Flush()
+}
+
+/**
+ * Compute when a bit of the waveform starts. PWM and PCM bits last as long as
+ * the clock divided by the integer divider programmed by setup_pwm and
+ * setup_pcm, SPI bits as long as the speed asked of spidev.
+ *
+ * @param    waveform  waveform description.
+ * @param    bit       index of the bit.
+ *
+ * @returns  start of the bit in picoseconds
+ */
+func waveform_bit_time(waveform Waveform, bit int) uint64 {
+	clocks, clock_freq := uint64(bit), 3*uint64(waveform.Freq)
+	if waveform.DriverMode != SPI {
+		osc := waveform.OscFreq
+		if osc == 0 {
+			osc = OSC_FREQ
+		}
+		clocks, clock_freq = uint64(bit)*uint64(osc/(3*waveform.Freq)), uint64(osc)
+	}
+
+	// clocks * 1e12 / clock_freq without overflowing
+	hi, lo := bits.Mul64(clocks, 1000000000000)
+	ps, _ := bits.Div64(hi, lo, clock_freq)
+	return ps
+}
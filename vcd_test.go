@@ -0,0 +1,187 @@
+package rpiws2811
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// WS2812B timing, in picoseconds: T0H 0.4µs and T1H 0.8µs ±150ns, a bit
+// 1.25µs ±600ns, latched by a reset of at least 50µs.
+const (
+	vcd_t0h       = 400000
+	vcd_t1h       = 800000
+	vcd_tolerance = 150000
+	vcd_bit       = 1250000
+	vcd_bit_tol   = 600000
+	vcd_reset     = 50000000
+)
+
+// vcd_pulse is a stretch of a VCD signal at one level.
+type vcd_pulse struct {
+	high       bool
+	start, end uint64 // ps
+}
+
+/**
+ * Parse the pulses of a signal of a Value Change Dump.
+ *
+ * @param    t     test.
+ * @param    vcd   the dump.
+ * @param    id    identifier of the signal.
+ *
+ * @returns  the pulses, in order
+ */
+func parse_vcd(t *testing.T, vcd []byte, id string) []vcd_pulse {
+	t.Helper()
+
+	var pulses []vcd_pulse
+	var now uint64
+	scanner := bufio.NewScanner(bytes.NewReader(vcd))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			var err error
+			if now, err = strconv.ParseUint(line[1:], 10, 64); err != nil {
+				t.Fatalf("bad timestamp %q", line)
+			}
+			if len(pulses) > 0 {
+				pulses[len(pulses)-1].end = now
+			}
+		case line == "0"+id || line == "1"+id:
+			pulses = append(pulses, vcd_pulse{high: line[0] == '1', start: now, end: now})
+		}
+	}
+	return pulses
+}
+
+func TestVCDTiming(t *testing.T) {
+	colors := []uint32{0x00a55af0, 0x00000000, 0x00ffffff, 0x00010080}
+
+	for _, mode := range []string{"pwm", "pcm", "spi"} {
+		var opts []StrandOption
+		gpio := map[string]int{"pwm": 18, "pcm": 21, "spi": 10}[mode]
+		if mode == "spi" {
+			path := filepath.Join(t.TempDir(), "spidev")
+			if err := os.WriteFile(path, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			opts = append(opts, WithSPIDevice(path))
+		}
+		strand, _, _ := fake_strand(t, gpio, false, opts...)
+
+		channel, err := strand.Channel(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := channel.CopyFrom(colors); err != nil {
+			t.Fatal(err)
+		}
+		if err := strand.Render(); err != nil {
+			t.Fatalf("%v: Render: %v", mode, err)
+		}
+		var vcd bytes.Buffer
+		if err := strand.Waveform().WriteVCD(&vcd, strand.Raw()); err != nil {
+			t.Fatalf("%v: WriteVCD: %v", mode, err)
+		}
+		if err := strand.Close(); err != nil {
+			t.Fatalf("%v: Close: %v", mode, err)
+		}
+
+		golden := filepath.Join("testdata", "vcd", mode+".vcd")
+		if *update {
+			if err := os.WriteFile(golden, vcd.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(vcd.Bytes(), want) {
+			t.Errorf("%v: VCD differs from %v", mode, golden)
+		}
+
+		// GRB, most significant bit first
+		var want_bits []bool
+		for _, color := range colors {
+			grb := (color>>8)&0xff<<16 | (color>>16)&0xff<<8 | color&0xff
+			for bit := 23; bit >= 0; bit-- {
+				want_bits = append(want_bits, (grb>>uint(bit))&1 != 0)
+			}
+		}
+
+		pulses := parse_vcd(t, vcd.Bytes(), "!")
+		var got_bits []bool
+		for i, pulse := range pulses {
+			width := pulse.end - pulse.start
+			if !pulse.high {
+				if i == len(pulses)-1 {
+					if width < vcd_reset {
+						t.Errorf("%v: reset of %vps, want at least %vps", mode, width, vcd_reset)
+					}
+				} else if i > 0 {
+					if period := pulse.end - pulses[i-1].start; period+vcd_bit_tol < vcd_bit || period > vcd_bit+vcd_bit_tol {
+						t.Errorf("%v: bit %v lasts %vps, want %vps ±%vps", mode, len(got_bits)-1, period, vcd_bit, vcd_bit_tol)
+					}
+				}
+				continue
+			}
+
+			one := width > (vcd_t0h+vcd_t1h)/2
+			high := uint64(vcd_t0h)
+			if one {
+				high = vcd_t1h
+			}
+			if width+vcd_tolerance < high || width > high+vcd_tolerance {
+				t.Errorf("%v: bit %v high for %vps, want %vps ±%vps", mode, len(got_bits), width, high, vcd_tolerance)
+			}
+			got_bits = append(got_bits, one)
+		}
+
+		if len(pulses) == 0 || pulses[len(pulses)-1].high {
+			t.Errorf("%v: signal doesn't end with a reset", mode)
+		}
+		if len(got_bits) != len(want_bits) {
+			t.Fatalf("%v: %v bits, want %v", mode, len(got_bits), len(want_bits))
+		}
+		for i := range want_bits {
+			if got_bits[i] != want_bits[i] {
+				t.Errorf("%v: bit %v is %v, want %v", mode, i, got_bits[i], want_bits[i])
+			}
+		}
+	}
+}
+
+func TestVCDMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		waveform Waveform
+		size     int
+	}{
+		{"pwm", Waveform{DriverMode: PWM, Freq: WS2811_TARGET_FREQ}, 12},
+		{"pcm", Waveform{DriverMode: PCM, Freq: WS2811_TARGET_FREQ}, 6},
+		{"mode", Waveform{DriverMode: NONE, Freq: WS2811_TARGET_FREQ}, 8},
+		{"freq", Waveform{DriverMode: SPI}, 8},
+	}
+
+	for _, test := range tests {
+		var vcd bytes.Buffer
+		err := test.waveform.WriteVCD(&vcd, make([]byte, test.size))
+		if !errors.Is(err, ErrMalformedWaveform) {
+			t.Errorf("%v: error %v, want ErrMalformedWaveform", test.name, err)
+		}
+		if vcd.Len() != 0 {
+			t.Errorf("%v: wrote %v bytes", test.name, vcd.Len())
+		}
+	}
+}
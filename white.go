@@ -0,0 +1,111 @@
+package rpiws2811
+
+import (
+	"fmt"
+	"math"
+)
+
+// WhiteMode is how the white of the LEDs of an RGBW strip is derived from
+// their red, green and blue, see SetWhite.
+type WhiteMode int
+
+const (
+	// WhiteNone sends the colors as given, the white only from their W.
+	WhiteNone WhiteMode = iota
+	// WhiteMinSubtract moves the gray part of the color, the least of red,
+	// green and blue, to the white LED, regardless of its temperature.
+	WhiteMinSubtract
+	// WhiteAccurate moves as much of the color as the white LED can show to
+	// it, given its temperature, and sends the rest on red, green and blue,
+	// preserving the color.
+	WhiteAccurate
+	// WhiteBoost lights the white LED as WhiteAccurate does but keeps red,
+	// green and blue, for brighter, less saturated colors.
+	WhiteBoost
+)
+
+var white_mode_names = [...]string{"none", "min-subtract", "accurate", "boost"}
+
+func (mode WhiteMode) String() string {
+	if mode < 0 || int(mode) >= len(white_mode_names) {
+		return fmt.Sprintf("WhiteMode(%d)", int(mode))
+	}
+	return white_mode_names[mode]
+}
+
+// SetWhite sets how the white of the LEDs is derived from their red, green and
+// blue from the next Render on, for the white LEDs of a color temperature of
+// kelvin, 3000 for warm white and 6500 for cool white. It only applies to
+// channels whose strip type has white, the white derived adding to the W of
+// the colors.
+func (channel *LEDStrandChannel) SetWhite(mode WhiteMode, kelvin float64) error {
+	if mode < WhiteNone || mode > WhiteBoost {
+		return ws2811_errorf(WS2811_ERROR_GENERIC, "SetWhite", "invalid white mode %v", mode)
+	}
+	if (mode == WhiteAccurate || mode == WhiteBoost) && !(kelvin >= 1000 && kelvin <= 40000) {
+		return ws2811_errorf(WS2811_ERROR_GENERIC, "SetWhite", "invalid white temperature %v K, must be 1000 to 40000", kelvin)
+	}
+	channel.white_mode = mode
+	channel.white = Kelvin(kelvin)
+	if mode == WhiteMinSubtract {
+		channel.white = RGB(0xff, 0xff, 0xff)
+	}
+	return nil
+}
+
+// White returns how the white of the LEDs is derived, and the color of the white LEDs.
+func (channel *LEDStrandChannel) White() (WhiteMode, Color) {
+	return channel.white_mode, channel.white
+}
+
+/**
+ * Derive the white of an LED from its red, green and blue.
+ *
+ * @param    mode   how the white is derived.
+ * @param    white  color of the white LED at full brightness, as red, green and blue.
+ * @param    led    color packed as 0xWWRRGGBB.
+ *
+ * @returns  the color with the white derived
+ */
+func white_extract(mode WhiteMode, white Color, led uint32) uint32 {
+	c := [LED_COLOURS]uint32{(led >> 16) & 0xff, (led >> 8) & 0xff, led & 0xff, (led >> 24) & 0xff}
+	white_extract_components(mode, white, &c, 0xff)
+	return c[ComponentWhite]<<24 | c[ComponentRed]<<16 | c[ComponentGreen]<<8 | c[ComponentBlue]
+}
+
+/**
+ * Derive the white of an LED from its red, green and blue, at any precision.
+ *
+ * @param    mode   how the white is derived.
+ * @param    white  color of the white LED at full brightness, as red, green and blue.
+ * @param    c      components of the LED, by Component, changed in place.
+ * @param    full   value of a component at full brightness, 0xff or 0xffff.
+ *
+ * @returns  None
+ */
+func white_extract_components(mode WhiteMode, white Color, c *[LED_COLOURS]uint32, full uint32) {
+	ref := [3]uint32{uint32(white.R()), uint32(white.G()), uint32(white.B())}
+
+	// The most of the white LED whose light fits in the color
+	w := full
+	for i := range ref {
+		if ref[i] != 0 && c[i]*0xff/ref[i] < w {
+			w = c[i] * 0xff / ref[i]
+		}
+	}
+
+	if mode != WhiteBoost {
+		for i := range ref {
+			sub := uint32(math.Round(float64(w*ref[i]) / 0xff))
+			if sub > c[i] {
+				sub = c[i]
+			}
+			c[i] -= sub
+		}
+	}
+
+	c[ComponentWhite] += w
+	if c[ComponentWhite] > full {
+		c[ComponentWhite] = full
+	}
+}
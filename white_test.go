@@ -0,0 +1,101 @@
+package rpiws2811
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWhiteModes(t *testing.T) {
+	colors := []uint32{0x00ffffff, 0x00804020, 0x20402010, 0x00ff0000}
+
+	tests := []struct {
+		mode   WhiteMode
+		kelvin float64
+		want   []uint32 // On the wire, 0xWWRRGGBB
+	}{
+		{WhiteNone, 0, colors},
+		// The least of red, green and blue moves to the white, which adds to W
+		{WhiteMinSubtract, 0, []uint32{0xff000000, 0x20602000, 0x30301000, 0x00ff0000}},
+		// The white of 2700 K is ffa757: as much of it as fits in the color
+		// moves to the white LED
+		{WhiteAccurate, 2700, []uint32{0xff0058a8, 0x5d230300, 0x4e120200, 0x00ff0000}},
+		// The same white, keeping red, green and blue
+		{WhiteBoost, 2700, []uint32{0xffffffff, 0x5d804020, 0x4e402010, 0x00ff0000}},
+	}
+
+	for _, test := range tests {
+		c1, err := NewLEDStrandChannel(18, len(colors), 255, false, SK6812_STRIP_RGBW)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c2, err := NewLEDStrandChannel(13, len(colors), 255, false, WS2811_STRIP_GRB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		strand, _, vc, err := fake_strand_channels(c1, c2, false)
+		if err != nil {
+			t.Fatalf("NewLEDStrand: %v", err)
+		}
+
+		for channum := 0; channum < RPI_PWM_CHANNELS; channum++ {
+			channel, err := strand.Channel(channum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := channel.SetWhite(test.mode, test.kelvin); err != nil {
+				t.Fatalf("%v: SetWhite: %v", test.mode, err)
+			}
+			if err := channel.CopyFrom(colors); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := strand.Render(); err != nil {
+			t.Fatalf("%v: Render: %v", test.mode, err)
+		}
+		leds, err := strand.Waveform().Decode(strand.Raw())
+		if err != nil {
+			t.Fatalf("%v: Decode: %v", test.mode, err)
+		}
+
+		for i, want := range test.want {
+			if leds[0][i] != want {
+				t.Errorf("%v: LED %v is %08x, want %08x", test.mode, i, leds[0][i], want)
+			}
+			// RGB strips have no white to derive, nor to send
+			if want := colors[i] & 0xffffff; leds[1][i] != want {
+				t.Errorf("%v: RGB LED %v is %08x, want %08x", test.mode, i, leds[1][i], want)
+			}
+		}
+
+		if err := strand.Close(); err != nil {
+			t.Errorf("%v: Close: %v", test.mode, err)
+		}
+		vc.Check(t)
+	}
+}
+
+func TestSetWhiteInvalid(t *testing.T) {
+	channel, err := NewLEDStrandChannel(18, 4, 255, false, SK6812_STRIP_RGBW)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode   WhiteMode
+		kelvin float64
+	}{
+		{WhiteMode(-1), 0},
+		{WhiteBoost + 1, 0},
+		{WhiteAccurate, 0},
+		{WhiteAccurate, 999},
+		{WhiteBoost, 40001},
+	}
+	for _, test := range tests {
+		if err := channel.SetWhite(test.mode, test.kelvin); !errors.Is(err, ErrGeneric) {
+			t.Errorf("SetWhite(%v, %v): %v, want ErrGeneric", test.mode, test.kelvin, err)
+		}
+	}
+	if mode, _ := channel.White(); mode != WhiteNone {
+		t.Errorf("white mode %v after errors, want none", mode)
+	}
+}
@@ -1,7 +1,8 @@
 package rpiws2811
 
 import (
-	"fmt"
+	"encoding/binary"
+	"errors"
 	"os"
 	"time"
 	"unsafe"
@@ -37,51 +38,74 @@ const (
 
 type (
 	LEDType      uint32
-	ws2811_led_t uint32
-
-	ws2811_channel_t struct {
-		gpionum    int           //< GPIO Pin with PWM alternate function, 0 if unused
-		invert     bool          //< Invert output signal
-		count      int           //< Number of LEDs, 0 if channel is unused
-		strip_type LEDType       //< Strip color layout -- one of WS2811_STRIP_xxx constants
-		leds       *ws2811_led_t //< LED buffers, allocated by driver based on count
-		brightness byte          //< Brightness value between 0 and 255
-		wshift     byte          //< White shift value
-		rshift     byte          //< Red shift value
-		gshift     byte          //< Green shift value
-		bshift     byte          //< Blue shift value
-		gamma      *byte         //< Gamma correction table
-	}
-
-	ws2811_t struct {
-		render_wait_time uint64         //< time in µs before the next render can run
-		device           *ws2811_device //< Private data for driver use
-		rpi_hw           *rpi_hw_t      //< RPI Hardware Information
-		freq             uint32         //< Required output frequency
-		dmanum           int            //< DMA number _not_ already in use
-		channel          [RPI_PWM_CHANNELS]ws2811_channel_t
+	ws2811_led_t = uint32 //< 0xWWRRGGBB
+
+	// LEDStrandChannel is one of the two outputs of a strand and holds its LEDs.
+	LEDStrandChannel struct {
+		gpionum    int                  //< GPIO Pin with PWM alternate function, 0 if unused
+		invert     bool                 //< Invert output signal
+		count      int                  //< Number of LEDs, 0 if channel is unused
+		strip_type LEDType              //< Strip color layout -- one of WS2811_STRIP_xxx constants
+		leds       []ws2811_led_t       //< LED buffers, allocated by driver based on count
+		brightness byte                 //< Brightness value between 0 and 255
+		wshift     byte                 //< White shift value
+		rshift     byte                 //< Red shift value
+		gshift     byte                 //< Green shift value
+		bshift     byte                 //< Blue shift value
+		gamma      [LED_COLOURS]*Gamma  //< Gamma correction of red, green, blue and white
+		white_mode WhiteMode            //< How the white is derived from red, green and blue
+		white      Color                //< Color of the white LEDs
+		dither     bool                 //< Render leds16 with temporal dithering
+		leds16     []Color64            //< 16-bit LED buffer, allocated when dithering
+		dither_err [][LED_COLOURS]int32 //< Error carried to the next frame, by LED and color sent
+		layout     Layout               //< How the LEDs are mounted
+		pin        *pin_spec            //< Pin given by SetPin, resolved to gpionum by ws2811_init
+	}
+
+	// LEDStrand drives up to two channels of LEDs from a single DMA channel.
+	LEDStrand struct {
+		render_wait_time   uint64         //< time in µs before the next render can run
+		previous_timestamp uint64         //< time in µs when the previous render was started
+		device             *ws2811_device //< Private data for driver use
+		rpi_hw             *rpi_hw_t      //< RPI Hardware Information
+		freq               uint32         //< Required output frequency
+		dmanum             int            //< DMA number _not_ already in use
+		channel            [RPI_PWM_CHANNELS]LEDStrandChannel
+		spi_dev            string           //< spidev device used in SPI mode
+		clear_on_exit      bool             //< Blank the LEDs when closing
+		handle_signals     bool             //< Stop Run on SIGINT and SIGTERM
+		mem                PeripheralMemory //< Physical memory the registers are mapped from
+		sinks              []FrameSink      //< Receive every rendered frame
+		videocore          VideoCore        //< Firmware allocating the DMA buffer
+		simulate           bool             //< Only send frames to the sinks, no hardware is used
+		clock              Clock            //< Tells the time and waits
+		scheduler          *Scheduler       //< Paces the frames of Run
+		cpuinfo            string           //< cpuinfo the board is detected from
+		device_tree        string           //< Root of the device tree, "" not to use it
+		frame_rate         float64          //< Frames per second achieved by Render, 0 if unknown
+		last_render        time.Time        //< Time of the previous render
 	}
 
 	ws2811_return_t int
 )
 
 const (
-	WS2811_SUCCESS                = 0
-	WS2811_ERROR_GENERIC          = -1
-	WS2811_ERROR_OUT_OF_MEMORY    = -2
-	WS2811_ERROR_HW_NOT_SUPPORTED = -3
-	WS2811_ERROR_MEM_LOCK         = -4
-	WS2811_ERROR_MMAP             = -5
-	WS2811_ERROR_MAP_REGISTERS    = -6
-	WS2811_ERROR_GPIO_INIT        = -7
-	WS2811_ERROR_PWM_SETUP        = -8
-	WS2811_ERROR_MAILBOX_DEVICE   = -9
-	WS2811_ERROR_DMA              = -10
-	WS2811_ERROR_ILLEGAL_GPIO     = -11
-	WS2811_ERROR_PCM_SETUP        = -12
-	WS2811_ERROR_SPI_SETUP        = -13
-	WS2811_ERROR_SPI_TRANSFER     = -14
-	WS2811_RETURN_STATE_COUNT     = -15 // I don't believe this is used anywhere...
+	WS2811_SUCCESS                ws2811_return_t = 0
+	WS2811_ERROR_GENERIC          ws2811_return_t = -1
+	WS2811_ERROR_OUT_OF_MEMORY    ws2811_return_t = -2
+	WS2811_ERROR_HW_NOT_SUPPORTED ws2811_return_t = -3
+	WS2811_ERROR_MEM_LOCK         ws2811_return_t = -4
+	WS2811_ERROR_MMAP             ws2811_return_t = -5
+	WS2811_ERROR_MAP_REGISTERS    ws2811_return_t = -6
+	WS2811_ERROR_GPIO_INIT        ws2811_return_t = -7
+	WS2811_ERROR_PWM_SETUP        ws2811_return_t = -8
+	WS2811_ERROR_MAILBOX_DEVICE   ws2811_return_t = -9
+	WS2811_ERROR_DMA              ws2811_return_t = -10
+	WS2811_ERROR_ILLEGAL_GPIO     ws2811_return_t = -11
+	WS2811_ERROR_PCM_SETUP        ws2811_return_t = -12
+	WS2811_ERROR_SPI_SETUP        ws2811_return_t = -13
+	WS2811_ERROR_SPI_TRANSFER     ws2811_return_t = -14
+	WS2811_RETURN_STATE_COUNT     ws2811_return_t = -15 // I don't believe this is used anywhere...
 )
 
 func getWS2811ReturnMessage(returnCode ws2811_return_t) string {
@@ -125,7 +149,8 @@ func getWS2811ReturnMessage(returnCode ws2811_return_t) string {
 // **** <ws2811.c> ****
 
 const (
-	OSC_FREQ = 19200000 // crystal = frequency
+	OSC_FREQ     = 19200000 // crystal = frequency
+	OSC_FREQ_PI4 = 54000000 // crystal of the BCM2711
 
 	/* 4 colors (R, G, B + W), 8 bits per byte, 3 symbols per bit + 55uS low for reset signal */
 	LED_COLOURS  = 4
@@ -149,10 +174,31 @@ const (
 	SPI  = 3
 )
 
+var driver_mode_names = [...]string{
+	NONE: "NONE",
+	PWM:  "PWM",
+	PCM:  "PCM",
+	SPI:  "SPI",
+}
+
 func BUS_TO_PHYS(x uint32) uint32 {
 	return ^(^x | 0xC0000000)
 }
 
+/**
+ * Frequency of the oscillator the PWM and PCM clocks are divided from.
+ *
+ * @param    rpi_hw  board.
+ *
+ * @returns  frequency in Hz
+ */
+func osc_freq(rpi_hw *rpi_hw_t) uint32 {
+	if rpi_hw.typeNum == RPI_HWVER_TYPE_PI4 {
+		return OSC_FREQ_PI4
+	}
+	return OSC_FREQ
+}
+
 func LED_BIT_COUNT(leds int, freq uint32) int {
 	first := leds * LED_COLOURS * 8 * 3
 	second := (LED_RESET_uS * (freq * 3)) / 1000000
@@ -173,24 +219,25 @@ func PCM_BYTE_COUNT(leds int, freq uint32) uint32 {
 // code are immediately visible to the DMA controller.  This struct
 // holds data relevant to the mailbox interface.
 type videocore_mbox_t struct {
-	handle    os.File        /* From mbox_open() */
+	handle    Mailbox        /* From videocore.Open() */
 	mem_ref   uint32         /* From mem_alloc() */
-	bus_addr  uintptr        /* From mem_lock() */
+	bus_addr  uint32         /* From mem_lock() */
 	size      uint32         /* Size of allocation */
-	virt_addr unsafe.Pointer /* From mapmem() */
+	mem       Registers      /* From mem.Map() */
+	virt_addr unsafe.Pointer /* From mem.Pointer() */
 }
 
 type ws2811_device struct {
 	driver_mode int
-	pxl_raw     *uint8 // TODO @jmbarzee volatile
-	dma         *dma_t // TODO @jmbarzee volatile
-	pwm         *pwm_t // TODO @jmbarzee volatile
-	pcm         *pcm_t // TODO @jmbarzee volatile
-	spi_fd      int
+	pxl_raw     []byte    // TODO @jmbarzee volatile
+	dma         Registers // dma_t
+	pwm         Registers // pwm_t
+	pcm         Registers // pcm_t
+	spi_file    *os.File
 	dma_cb      *dma_cb_t // TODO @jmbarzee volatile
 	dma_cb_addr uint32
-	gpio        *gpio_t   // TODO @jmbarzee volatile
-	cm_clk      *cm_clk_t // TODO @jmbarzee volatile
+	gpio        Registers // gpio_t
+	cm_clk      Registers // cm_clk_t
 	mbox        videocore_mbox_t
 	max_count   int
 }
@@ -199,11 +246,11 @@ type ws2811_device struct {
 
 // **** </ws2811.c> ****
 
-func get_microsecond_timestamp() uint64 {
-	return uint64(time.Now().UnixNano() / int64(time.Millisecond))
+func get_microsecond_timestamp(clock Clock) uint64 {
+	return uint64(clock.Now().UnixNano() / int64(time.Microsecond))
 }
 
-func max_channel_led_count(strand *ws2811_t) int {
+func max_channel_led_count(strand *LEDStrand) int {
 	max := 0
 	for _, channel := range strand.channel {
 		if channel.count > max {
@@ -213,38 +260,38 @@ func max_channel_led_count(strand *ws2811_t) int {
 	return max
 }
 
-func map_registers(strand *ws2811_t) error {
+func map_registers(strand *LEDStrand) error {
 	device := strand.device
 	rpi_hw := strand.rpi_hw // const
 	base := strand.rpi_hw.periph_base
+	mem := strand.mem
 	var dma_addr uint32
 	offset := uint32(0)
+	var err error
 
-	dma_addr = dmanum_to_offset(strand.dmanum)
-	if dma_addr == 0 {
-		return fmt.Errorf("invalid dma_addr %v", dma_addr)
+	if err := dma_check(rpi_hw, strand.dmanum); err != nil {
+		return err
 	}
+	dma_addr = dmanum_to_offset(strand.dmanum)
 	dma_addr += rpi_hw.periph_base
 
-	device.dma = (*dma_t)(mapmem(dma_addr, unsafe.Sizeof(dma_t{}), DEV_MEM))
-	if device.dma == nil {
-		return fmt.Errorf("invalid device.dma nil")
+	device.dma, err = mem.Map(dma_addr, unsafe.Sizeof(dma_t{}))
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_MAP_REGISTERS, "map_registers dma", err)
 	}
 
 	switch device.driver_mode {
 	case PWM:
-		device.pwm = (*pwm_t)(mapmem(PWM_OFFSET+base, unsafe.Sizeof(pwm_t{}), DEV_MEM))
-		if device.pwm == nil {
-			return fmt.Errorf("invalid device.pwm nil")
+		device.pwm, err = mem.Map(PWM_OFFSET+base, unsafe.Sizeof(pwm_t{}))
+		if err != nil {
+			return ws2811_error(WS2811_ERROR_MAP_REGISTERS, "map_registers pwm", err)
 		}
-		break
 
 	case PCM:
-		device.pcm = (*pcm_t)(mapmem(PCM_OFFSET+base, unsafe.Sizeof(pcm_t{}), DEV_MEM))
-		if device.pcm == nil {
-			return fmt.Errorf("invalid device.pcm nil")
+		device.pcm, err = mem.Map(PCM_OFFSET+base, unsafe.Sizeof(pcm_t{}))
+		if err != nil {
+			return ws2811_error(WS2811_ERROR_MAP_REGISTERS, "map_registers pcm", err)
 		}
-		break
 	}
 
 	/*
@@ -252,50 +299,55 @@ func map_registers(strand *ws2811_t) error {
 	 * However, it used /dev/mem before, so I'm leaving it as such.
 	 */
 
-	device.gpio = (*gpio_t)(mapmem(GPIO_OFFSET+base, unsafe.Sizeof(gpio_t{}), DEV_MEM))
-	if device.gpio == nil {
-		return fmt.Errorf("invalid device.gpio nil")
+	device.gpio, err = mem.Map(GPIO_OFFSET+base, unsafe.Sizeof(gpio_t{}))
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_MAP_REGISTERS, "map_registers gpio", err)
 	}
 
 	switch device.driver_mode {
 	case PWM:
 		offset = CM_PWM_OFFSET
-		break
 	case PCM:
 		offset = CM_PCM_OFFSET
-		break
 	}
-	device.cm_clk = (*cm_clk_t)(mapmem(offset+base, unsafe.Sizeof(cm_clk_t{}), DEV_MEM))
-	if device.cm_clk == nil {
-		return fmt.Errorf("invalid device.cm_clk nil")
+	device.cm_clk, err = mem.Map(offset+base, unsafe.Sizeof(cm_clk_t{}))
+	if err != nil {
+		return ws2811_error(WS2811_ERROR_MAP_REGISTERS, "map_registers cm_clk", err)
 	}
 
 	return nil
 }
 
-func unmap_registers(strand *ws2811_t) {
+func unmap_registers(strand *LEDStrand) error {
 	device := strand.device
+	var errs []error
 
 	if device.dma != nil {
-		unmapmem(unsafe.Pointer(device.dma), unsafe.Sizeof(dma_t{}))
+		errs = append(errs, device.dma.Unmap())
+		device.dma = nil
 	}
 
 	if device.pwm != nil {
-		unmapmem(unsafe.Pointer(device.pwm), unsafe.Sizeof(pwm_t{}))
+		errs = append(errs, device.pwm.Unmap())
+		device.pwm = nil
 	}
 
 	if device.pcm != nil {
-		unmapmem(unsafe.Pointer(device.pcm), unsafe.Sizeof(pcm_t{}))
+		errs = append(errs, device.pcm.Unmap())
+		device.pcm = nil
 	}
 
 	if device.cm_clk != nil {
-		unmapmem(unsafe.Pointer(device.cm_clk), unsafe.Sizeof(cm_clk_t{}))
+		errs = append(errs, device.cm_clk.Unmap())
+		device.cm_clk = nil
 	}
 
 	if device.gpio != nil {
-		unmapmem(unsafe.Pointer(device.gpio), unsafe.Sizeof(gpio_t{}))
+		errs = append(errs, device.gpio.Unmap())
+		device.gpio = nil
 	}
 
+	return errors.Join(errs...)
 }
 
 /**
@@ -306,12 +358,10 @@ func unmap_registers(strand *ws2811_t) {
  *
  * @returns  Bus address for use by DMA.
  */
-func addr_to_bus(device *ws2811_device, virt uintptr) uintptr {
+func addr_to_bus(device *ws2811_device, virt unsafe.Pointer) uint32 {
 	mbox := &device.mbox
 
-	var sizeExample *uint8
-
-	offset := uintptr(virt - uintptr(unsafe.Pointer(mbox.virt_addr))*unsafe.Sizeof(sizeExample))
+	offset := uint32(uintptr(virt) - uintptr(mbox.virt_addr))
 
 	return mbox.bus_addr + offset
 }
@@ -323,21 +373,20 @@ func addr_to_bus(device *ws2811_device, virt uintptr) uintptr {
  *
  * @returns  None
  */
-func stop_pwm(strand *ws2811_t) {
+func stop_pwm(strand *LEDStrand) {
 	pwm := strand.device.pwm
 	cm_clk := strand.device.cm_clk
 
 	// Turn off the PWM in case already running
-	pwm.ctl = 0
+	pwm.Write32(PWM_CTL, 0)
 	// TODO @jmbarzee discover what is going on here... waiting for writes to go through? 4 total
-	time.Sleep(time.Microsecond * 10)
+	strand.clock.Sleep(time.Microsecond * 10)
 
 	// Kill the clock if it was already running
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL
-	time.Sleep(time.Microsecond * 10)
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_KILL)
+	strand.clock.Sleep(time.Microsecond * 10)
 
-	// TODO @jmbarzee dear god, this may not work
-	for (cm_clk.ctl & CM_CLK_CTL_BUSY) != 0 {
+	for (cm_clk.Read32(CM_CLK_CTL) & CM_CLK_CTL_BUSY) != 0 {
 	}
 
 }
@@ -349,18 +398,18 @@ func stop_pwm(strand *ws2811_t) {
  *
  * @returns  None
  */
-func stop_pcm(strand *ws2811_t) {
+func stop_pcm(strand *LEDStrand) {
 	pcm := strand.device.pcm
 	cm_clk := strand.device.cm_clk
 
 	// Turn off the PCM in case already running
-	pcm.cs = 0
-	time.Sleep(time.Microsecond * 10)
+	pcm.Write32(PCM_CS, 0)
+	strand.clock.Sleep(time.Microsecond * 10)
 
 	// Kill the clock if it was already running
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL
-	time.Sleep(time.Microsecond * 10)
-	for (cm_clk.ctl & CM_CLK_CTL_BUSY) != 0 {
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_KILL)
+	strand.clock.Sleep(time.Microsecond * 10)
+	for (cm_clk.Read32(CM_CLK_CTL) & CM_CLK_CTL_BUSY) != 0 {
 	}
 
 }
@@ -372,7 +421,7 @@ func stop_pcm(strand *ws2811_t) {
  *
  * @returns  None
  */
-func setup_pwm(strand *ws2811_t) {
+func setup_pwm(strand *LEDStrand) {
 	dma := strand.device.dma
 	dma_cb := strand.device.dma_cb
 	pwm := strand.device.pwm
@@ -383,12 +432,12 @@ func setup_pwm(strand *ws2811_t) {
 
 	stop_pwm(strand)
 
-	// Setup the Clock - Use OSC @ 19.2Mhz w/ 3 clocks/tick
-	cm_clk.div = CM_CLK_DIV_PASSWD | CM_CLK_DIV_DIVI(OSC_FREQ/(3*freq))
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC | CM_CLK_CTL_ENAB
-	time.Sleep(time.Microsecond * 10)
-	for (cm_clk.ctl & CM_CLK_CTL_BUSY) == 0 {
+	// Setup the Clock - Use OSC @ 19.2Mhz (54Mhz on the Pi 4) w/ 3 clocks/tick
+	cm_clk.Write32(CM_CLK_DIV, CM_CLK_DIV_PASSWD|CM_CLK_DIV_DIVI(osc_freq(strand.rpi_hw)/(3*freq)))
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_SRC_OSC)
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_SRC_OSC|CM_CLK_CTL_ENAB)
+	strand.clock.Sleep(time.Microsecond * 10)
+	for (cm_clk.Read32(CM_CLK_CTL) & CM_CLK_CTL_BUSY) == 0 {
 
 	}
 
@@ -398,22 +447,23 @@ func setup_pwm(strand *ws2811_t) {
 	// busy.  The FIFO will clock out data at a much slower rate (2.6Mhz max), so
 	// the odds of a DMA priority boost are extremely low.
 
-	pwm.rng1 = 32 // 32-bits per word to serialize
-	time.Sleep(time.Microsecond * 10)
-	pwm.ctl = RPI_PWM_CTL_CLRF1
-	time.Sleep(time.Microsecond * 10)
-	pwm.dmac = RPI_PWM_DMAC_ENAB | RPI_PWM_DMAC_PANIC(7) | RPI_PWM_DMAC_DREQ(3)
-	time.Sleep(time.Microsecond * 10)
-	pwm.ctl = RPI_PWM_CTL_USEF1 | RPI_PWM_CTL_MODE1 |
+	pwm.Write32(PWM_RNG1, 32) // 32-bits per word to serialize
+	strand.clock.Sleep(time.Microsecond * 10)
+	pwm.Write32(PWM_CTL, RPI_PWM_CTL_CLRF1)
+	strand.clock.Sleep(time.Microsecond * 10)
+	pwm.Write32(PWM_DMAC, RPI_PWM_DMAC_ENAB|RPI_PWM_DMAC_PANIC(7)|RPI_PWM_DMAC_DREQ(3))
+	strand.clock.Sleep(time.Microsecond * 10)
+	ctl := RPI_PWM_CTL_USEF1 | RPI_PWM_CTL_MODE1 |
 		RPI_PWM_CTL_USEF2 | RPI_PWM_CTL_MODE2
 	if strand.channel[0].invert {
-		pwm.ctl |= RPI_PWM_CTL_POLA1
+		ctl |= RPI_PWM_CTL_POLA1
 	}
 	if strand.channel[1].invert {
-		pwm.ctl |= RPI_PWM_CTL_POLA2
+		ctl |= RPI_PWM_CTL_POLA2
 	}
-	time.Sleep(time.Microsecond * 10)
-	pwm.ctl |= RPI_PWM_CTL_PWEN1 | RPI_PWM_CTL_PWEN2
+	pwm.Write32(PWM_CTL, ctl)
+	strand.clock.Sleep(time.Microsecond * 10)
+	reg_set(pwm, PWM_CTL, RPI_PWM_CTL_PWEN1|RPI_PWM_CTL_PWEN2)
 
 	// Initialize the DMA control block
 	byte_count = PWM_BYTE_COUNT(maxcount, freq)
@@ -423,15 +473,15 @@ func setup_pwm(strand *ws2811_t) {
 		RPI_DMA_TI_PERMAP(5) | // PWM peripheral
 		RPI_DMA_TI_SRC_INC // Increment src addr
 
-	dma_cb.source_ad = addr_to_bus(strand.device, uintptr(unsafe.Pointer(strand.device.pxl_raw)))
+	dma_cb.source_ad = addr_to_bus(strand.device, unsafe.Pointer(&strand.device.pxl_raw[0]))
 
-	dma_cb.dest_ad = uintptr(unsafe.Pointer(&(*pwm_t)(unsafe.Pointer(uintptr(PWM_PERIPH_PHYS))).fif1))
+	dma_cb.dest_ad = PWM_PERIPH_PHYS + uint32(unsafe.Offsetof(pwm_t{}.fif1))
 	dma_cb.txfr_len = byte_count
 	dma_cb.stride = 0
 	dma_cb.nextconbk = 0
 
-	dma.cs = 0
-	dma.txfr_len = 0
+	dma.Write32(DMA_CS, 0)
+	dma.Write32(DMA_TXFR_LEN, 0)
 }
 
 /**
@@ -441,7 +491,7 @@ func setup_pwm(strand *ws2811_t) {
  *
  * @returns  None
  */
-func setup_pcm(strand *ws2811_t) {
+func setup_pcm(strand *LEDStrand) {
 	dma := strand.device.dma
 	dma_cb := strand.device.dma_cb
 	pcm := strand.device.pcm
@@ -453,12 +503,12 @@ func setup_pcm(strand *ws2811_t) {
 
 	stop_pcm(strand)
 
-	// Setup the PCM Clock - Use OSC @ 19.2Mhz w/ 3 clocks/tick
-	cm_clk.div = CM_CLK_DIV_PASSWD | CM_CLK_DIV_DIVI(OSC_FREQ/(3*freq))
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC
-	cm_clk.ctl = CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC | CM_CLK_CTL_ENAB
-	time.Sleep(time.Microsecond * 10)
-	for (cm_clk.ctl & CM_CLK_CTL_BUSY) == 0 {
+	// Setup the PCM Clock - Use OSC @ 19.2Mhz (54Mhz on the Pi 4) w/ 3 clocks/tick
+	cm_clk.Write32(CM_CLK_DIV, CM_CLK_DIV_PASSWD|CM_CLK_DIV_DIVI(osc_freq(strand.rpi_hw)/(3*freq)))
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_SRC_OSC)
+	cm_clk.Write32(CM_CLK_CTL, CM_CLK_CTL_PASSWD|CM_CLK_CTL_SRC_OSC|CM_CLK_CTL_ENAB)
+	strand.clock.Sleep(time.Microsecond * 10)
+	for (cm_clk.Read32(CM_CLK_CTL) & CM_CLK_CTL_BUSY) == 0 {
 
 	}
 
@@ -468,15 +518,15 @@ func setup_pcm(strand *ws2811_t) {
 	// busy.  The FIFO will clock out data at a much slower rate (2.6Mhz max), so
 	// the odds of a DMA priority boost are extremely low.
 
-	pcm.cs = RPI_PCM_CS_EN // Enable PCM hardware
-	pcm.mode = (RPI_PCM_MODE_FLEN(31) | RPI_PCM_MODE_FSLEN(1))
+	pcm.Write32(PCM_CS, RPI_PCM_CS_EN) // Enable PCM hardware
+	pcm.Write32(PCM_MODE, RPI_PCM_MODE_FLEN(31)|RPI_PCM_MODE_FSLEN(1))
 	// Framelength 32, clock enabled, frame sync pulse
-	pcm.txc = RPI_PCM_TXC_CH1WEX | RPI_PCM_TXC_CH1EN | RPI_PCM_TXC_CH1POS(0) | RPI_PCM_TXC_CH1WID(8)
+	pcm.Write32(PCM_TXC, RPI_PCM_TXC_CH1WEX|RPI_PCM_TXC_CH1EN|RPI_PCM_TXC_CH1POS(0)|RPI_PCM_TXC_CH1WID(8))
 	// Single 32-bit channel
-	pcm.cs |= RPI_PCM_CS_TXCLR // Reset transmit fifo
-	time.Sleep(time.Microsecond * 10)
-	pcm.cs |= RPI_PCM_CS_DMAEN                                       // Enable DMA DREQ
-	pcm.dreq = (RPI_PCM_DREQ_TX(0x3F) | RPI_PCM_DREQ_TX_PANIC(0x10)) // Set FIFO tresholds
+	reg_set(pcm, PCM_CS, RPI_PCM_CS_TXCLR) // Reset transmit fifo
+	strand.clock.Sleep(time.Microsecond * 10)
+	reg_set(pcm, PCM_CS, RPI_PCM_CS_DMAEN)                                   // Enable DMA DREQ
+	pcm.Write32(PCM_DREQ, RPI_PCM_DREQ_TX(0x3F)|RPI_PCM_DREQ_TX_PANIC(0x10)) // Set FIFO tresholds
 
 	// Initialize the DMA control block
 	byte_count = PCM_BYTE_COUNT(maxcount, freq)
@@ -486,14 +536,14 @@ func setup_pcm(strand *ws2811_t) {
 		RPI_DMA_TI_PERMAP(2) | // PCM TX peripheral
 		RPI_DMA_TI_SRC_INC // Increment src addr
 
-	dma_cb.source_ad = addr_to_bus(strand.device, uintptr(unsafe.Pointer(strand.device.pxl_raw)))
-	dma_cb.dest_ad = uintptr(unsafe.Pointer(&(*pcm_t)(unsafe.Pointer(uintptr(PCM_PERIPH_PHYS))).fifo))
+	dma_cb.source_ad = addr_to_bus(strand.device, unsafe.Pointer(&strand.device.pxl_raw[0]))
+	dma_cb.dest_ad = PCM_PERIPH_PHYS + uint32(unsafe.Offsetof(pcm_t{}.fifo))
 	dma_cb.txfr_len = byte_count
 	dma_cb.stride = 0
 	dma_cb.nextconbk = 0
 
-	dma.cs = 0
-	dma.txfr_len = 0
+	dma.Write32(DMA_CS, 0)
+	dma.Write32(DMA_TXFR_LEN, 0)
 }
 
 /**
@@ -504,26 +554,26 @@ func setup_pcm(strand *ws2811_t) {
  *
  * @returns  None
  */
-func dma_start(strand *ws2811_t) {
+func dma_start(strand *LEDStrand) {
 	dma := strand.device.dma
 	pcm := strand.device.pcm
 	dma_cb_addr := strand.device.dma_cb_addr
 
-	dma.cs = RPI_DMA_CS_RESET
-	time.Sleep(time.Microsecond * 10)
+	dma.Write32(DMA_CS, RPI_DMA_CS_RESET)
+	strand.clock.Sleep(time.Microsecond * 10)
 
-	dma.cs = RPI_DMA_CS_INT | RPI_DMA_CS_END
-	time.Sleep(time.Microsecond * 10)
+	dma.Write32(DMA_CS, RPI_DMA_CS_INT|RPI_DMA_CS_END)
+	strand.clock.Sleep(time.Microsecond * 10)
 
-	dma.conblk_ad = dma_cb_addr
-	dma.debug = 7 // clear debug error flags
-	dma.cs = RPI_DMA_CS_WAIT_OUTSTANDING_WRITES |
-		RPI_DMA_CS_PANIC_PRIORITY(15) |
-		RPI_DMA_CS_PRIORITY(15) |
-		RPI_DMA_CS_ACTIVE
+	dma.Write32(DMA_CONBLK_AD, dma_cb_addr)
+	dma.Write32(DMA_DEBUG, 7) // clear debug error flags
+	dma.Write32(DMA_CS, RPI_DMA_CS_WAIT_OUTSTANDING_WRITES|
+		RPI_DMA_CS_PANIC_PRIORITY(15)|
+		RPI_DMA_CS_PRIORITY(15)|
+		RPI_DMA_CS_ACTIVE)
 
 	if strand.device.driver_mode == PCM {
-		pcm.cs |= RPI_PCM_CS_TXON // Start transmission
+		reg_set(pcm, PCM_CS, RPI_PCM_CS_TXON) // Start transmission
 	}
 }
 
@@ -534,7 +584,7 @@ func dma_start(strand *ws2811_t) {
  *
  * @returns  0 on success, -1 on unsupported pin
  */
-func gpio_init(strand ws2811_t) error {
+func gpio_init(strand *LEDStrand) error {
 	gpio := strand.device.gpio
 
 	for i, channel := range strand.channel {
@@ -557,7 +607,7 @@ func gpio_init(strand ws2811_t) error {
 				}
 				break
 			default:
-				return fmt.Errorf("Unrecognized driver_mode %v", strand.device.driver_mode)
+				return ws2811_errorf(WS2811_ERROR_GPIO_INIT, "gpio_init", "unrecognized driver_mode %v", strand.device.driver_mode)
 			}
 
 			gpio_function_set(gpio, pinnum, altnum)
@@ -575,17 +625,574 @@ func gpio_init(strand ws2811_t) error {
  *
  * @returns  None
  */
-func pwm_raw_init(strand *ws2811_t) {
+func pwm_raw_init(strand *LEDStrand) {
 	pxl_raw := strand.device.pxl_raw
 	maxcount := strand.device.max_count
 	wordcount := (PWM_BYTE_COUNT(maxcount, strand.freq) / uint32(unsafe.Sizeof(uint32(0)))) / RPI_PWM_CHANNELS
 
-	for i, channel := range strand.channel {
-		wordpos := i
+	for channum := range strand.channel {
+		wordpos := channum
 
 		for i := uint32(0); i < wordcount; i++ {
-			pxl_raw[wordpos] = 0x0
+			binary.LittleEndian.PutUint32(pxl_raw[wordpos*4:], 0x0)
 			wordpos += 2
 		}
 	}
 }
+
+/**
+ * Initialize the PCM DMA buffer with all zeros, or all ones when inverted as
+ * inversion is handled by software, so the reset time idles at the right level.
+ * The DMA buffer length is assumed to be a word multiple.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  None
+ */
+func pcm_raw_init(strand *LEDStrand) {
+	pxl_raw := strand.device.pxl_raw
+	maxcount := strand.device.max_count
+	wordcount := PCM_BYTE_COUNT(maxcount, strand.freq) / uint32(unsafe.Sizeof(uint32(0)))
+	idle := uint32(0x0)
+	if strand.channel[0].invert {
+		idle = 0xffffffff
+	}
+
+	for i := uint32(0); i < wordcount; i++ {
+		binary.LittleEndian.PutUint32(pxl_raw[i*4:], idle)
+	}
+}
+
+/**
+ * Allocate the LED buffer of a channel and fill in the strip type, default
+ * gamma table and color shifts.
+ *
+ * @param    channel  channel instance pointer.
+ *
+ * @returns  None
+ */
+func ws2811_channel_init(channel *LEDStrandChannel) {
+	channel.leds = make([]ws2811_led_t, channel.count)
+	if channel.dither {
+		channel.leds16 = make([]Color64, channel.count)
+		channel.dither_err = make([][LED_COLOURS]int32, channel.count)
+	}
+
+	if channel.strip_type == 0 {
+		channel.strip_type = WS2811_STRIP_RGB
+	}
+
+	// Leave the components without gamma correction uncorrected
+	for i := range channel.gamma {
+		if channel.gamma[i] == nil {
+			channel.gamma[i] = gamma_linear
+		}
+	}
+
+	channel.wshift = byte((channel.strip_type >> 24) & 0xff)
+	channel.rshift = byte((channel.strip_type >> 16) & 0xff)
+	channel.gshift = byte((channel.strip_type >> 8) & 0xff)
+	channel.bshift = byte((channel.strip_type >> 0) & 0xff)
+}
+
+/**
+ * Cleanup previously allocated device memory and buffers.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, otherwise the errors of every step which failed
+ */
+func ws2811_cleanup(strand *LEDStrand) error {
+	device := strand.device
+	var errs []error
+
+	for i := range strand.channel {
+		strand.channel[i].leds = nil
+		strand.channel[i].leds16 = nil
+		strand.channel[i].dither_err = nil
+	}
+
+	if device == nil {
+		return nil
+	}
+
+	if device.mbox.handle != nil {
+		mbox := &device.mbox
+
+		if mbox.mem != nil {
+			errs = append(errs, mbox.mem.Unmap())
+			mbox.mem = nil
+			mbox.virt_addr = nil
+			device.pxl_raw = nil
+			device.dma_cb = nil
+		}
+		errs = append(errs, mem_unlock(mbox.handle, mbox.mem_ref))
+		errs = append(errs, mem_free(mbox.handle, mbox.mem_ref))
+		errs = append(errs, mbox.handle.Close())
+
+		mbox.handle = nil
+	}
+
+	if device.spi_file != nil {
+		errs = append(errs, device.spi_file.Close())
+		device.spi_file = nil
+	}
+
+	strand.device = nil
+	return errors.Join(errs...)
+}
+
+/**
+ * Select the driver mode from the function of the gpio of channel 0 and check
+ * that channel 1 can be driven alongside it.
+ *
+ * @param    ws2811    ws2811 instance pointer.
+ * @param    function  function of the gpio of channel 0.
+ *
+ * @returns  nil on success, error describing the illegal combination otherwise
+ */
+func set_driver_mode(strand *LEDStrand, function pin_function_t) error {
+	gpionum := strand.channel[0].gpionum
+	gpionum2 := strand.channel[1].gpionum
+	count2 := strand.channel[1].count
+
+	switch {
+	case function.name == PIN_FUNC_PWM0:
+		strand.device.driver_mode = PWM
+		// Check gpio for PWM1 (2nd channel) is OK if used
+		if gpionum2 == 0 && count2 == 0 {
+			return nil
+		}
+		_, err := board_check_gpio(strand.rpi_hw, 1, gpionum2, channel1_function, PIN_FUNC_PWM1)
+		return err
+	case function.name == PIN_FUNC_PCM_DOUT:
+		strand.device.driver_mode = PCM
+	default:
+		strand.device.driver_mode = SPI
+	}
+
+	// PCM and SPI only drive a single channel
+	if gpionum2 != 0 || count2 != 0 {
+		return ws2811_errorf(WS2811_ERROR_ILLEGAL_GPIO, "set_driver_mode", "%v on gpio %v drives a single channel, LED channel 1 (gpio %v, %v LEDs) must be unused", driver_mode_names[strand.device.driver_mode], gpionum, gpionum2, count2)
+	}
+	strand.channel[1] = LEDStrandChannel{}
+
+	return nil
+}
+
+/**
+ * Check that the gpio of channel 0 is broken out on this board with a
+ * function which can drive it and set the driver mode accordingly.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error describing the illegal gpio otherwise
+ */
+func check_hwver_and_gpionum(strand *LEDStrand) error {
+	rpi_hw := strand.rpi_hw
+
+	if strand.channel[0].count == 0 && strand.channel[1].count > 0 {
+		// Special case: nothing in channel 0, channel 1 only PWM1 allowed
+		if _, err := board_check_gpio(rpi_hw, 1, strand.channel[1].gpionum, channel1_function, PIN_FUNC_PWM1); err != nil {
+			return err
+		}
+		strand.device.driver_mode = PWM
+		return nil
+	}
+
+	function, err := board_check_gpio(rpi_hw, 0, strand.channel[0].gpionum, channel0_function, "PWM0, PCM_DOUT or SPI MOSI")
+	if err != nil {
+		return err
+	}
+	// Set driver mode (PWM, PCM, or SPI)
+	return set_driver_mode(strand, function)
+}
+
+/**
+ * Resolve the pins the channels were given by SetPin to gpios of this board.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error if the board has no such pin
+ */
+func resolve_channel_pins(strand *LEDStrand) error {
+	for i := range strand.channel {
+		channel := &strand.channel[i]
+		if channel.pin == nil {
+			continue
+		}
+		gpionum, err := resolve_pin(strand.rpi_hw, channel.pin)
+		if err != nil {
+			return err
+		}
+		channel.gpionum = gpionum
+	}
+	return nil
+}
+
+/*
+ *
+ * Application API Functions
+ *
+ */
+
+/**
+ * Allocate and initialize memory, buffers, pages, PWM, DMA, and GPIO.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, otherwise an error naming the step which failed.
+ */
+func ws2811_init(strand *LEDStrand) error {
+	var err error
+
+	if strand.simulate {
+		strand.rpi_hw = &sim_rpi_hw
+	} else {
+		strand.rpi_hw, err = rpi_hw_detect_dt(strand.cpuinfo, strand.device_tree)
+		if err != nil {
+			return err
+		}
+	}
+	rpi_hw := strand.rpi_hw
+
+	strand.device = &ws2811_device{}
+	device := strand.device
+
+	if err := resolve_channel_pins(strand); err != nil {
+		ws2811_cleanup(strand)
+		return err
+	}
+	if err := check_hwver_and_gpionum(strand); err != nil {
+		ws2811_cleanup(strand)
+		return err
+	}
+
+	device.max_count = max_channel_led_count(strand)
+
+	if strand.simulate {
+		sim_init(strand)
+		return nil
+	}
+
+	if device.driver_mode == SPI {
+		if err := spi_init(strand); err != nil {
+			unmap_registers(strand)
+			ws2811_cleanup(strand)
+			return err
+		}
+		return nil
+	}
+
+	// Determine how much physical memory we need for DMA
+	switch device.driver_mode {
+	case PWM:
+		device.mbox.size = PWM_BYTE_COUNT(device.max_count, strand.freq) +
+			uint32(unsafe.Sizeof(dma_cb_t{}))
+	case PCM:
+		device.mbox.size = PCM_BYTE_COUNT(device.max_count, strand.freq) +
+			uint32(unsafe.Sizeof(dma_cb_t{}))
+	}
+	// Round up to page size multiple
+	device.mbox.size = (device.mbox.size + (PAGE_SIZE - 1)) & ^uint32(PAGE_SIZE-1)
+
+	device.mbox.handle, err = strand.videocore.Open()
+	if err != nil {
+		ws2811_cleanup(strand)
+		return err
+	}
+
+	flags := uint32(0x4)
+	if rpi_hw.videocore_base == 0x40000000 {
+		flags = 0xC
+	}
+	device.mbox.mem_ref, err = mem_alloc(device.mbox.handle, device.mbox.size, PAGE_SIZE, flags)
+	if err != nil {
+		device.mbox.handle.Close()
+		device.mbox.handle = nil
+		ws2811_cleanup(strand)
+		return err
+	}
+
+	device.mbox.bus_addr, err = mem_lock(device.mbox.handle, device.mbox.mem_ref)
+	if err != nil {
+		mem_free(device.mbox.handle, device.mbox.mem_ref)
+		device.mbox.handle.Close()
+		device.mbox.handle = nil
+		ws2811_cleanup(strand)
+		return err
+	}
+
+	device.mbox.mem, err = strand.mem.Map(BUS_TO_PHYS(device.mbox.bus_addr), uintptr(device.mbox.size))
+	if err != nil {
+		ws2811_cleanup(strand)
+		return err
+	}
+	device.mbox.virt_addr = device.mbox.mem.Pointer()
+
+	// Allocate the LED buffers
+	for i := range strand.channel {
+		ws2811_channel_init(&strand.channel[i])
+	}
+
+	// The DMA control block sits at the start of the allocation, followed by the raw pixel data
+	cbSize := unsafe.Sizeof(dma_cb_t{})
+	device.dma_cb = (*dma_cb_t)(device.mbox.virt_addr)
+	device.pxl_raw = unsafe.Slice((*byte)(unsafe.Add(device.mbox.virt_addr, cbSize)), uintptr(device.mbox.size)-cbSize)
+
+	switch device.driver_mode {
+	case PWM:
+		pwm_raw_init(strand)
+	case PCM:
+		pcm_raw_init(strand)
+	}
+
+	*device.dma_cb = dma_cb_t{}
+
+	// Cache the DMA control block bus address
+	device.dma_cb_addr = addr_to_bus(device, unsafe.Pointer(device.dma_cb))
+
+	// Map the physical registers into userspace
+	if err := map_registers(strand); err != nil {
+		unmap_registers(strand)
+		ws2811_cleanup(strand)
+		return err
+	}
+
+	// Initialize the GPIO pins
+	if err := gpio_init(strand); err != nil {
+		unmap_registers(strand)
+		ws2811_cleanup(strand)
+		return ws2811_error(WS2811_ERROR_GPIO_INIT, "gpio_init", err)
+	}
+
+	switch device.driver_mode {
+	case PWM:
+		// Setup the PWM, clocks, and DMA
+		setup_pwm(strand)
+	case PCM:
+		// Setup the PCM, clock, and DMA
+		setup_pcm(strand)
+	}
+
+	return nil
+}
+
+/**
+ * Shut down DMA, PWM, and cleanup memory.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, otherwise the errors of every step which failed
+ */
+func ws2811_fini(strand *LEDStrand) error {
+	var errs []error
+
+	if strand.clear_on_exit {
+		// Dithering channels send their 16-bit colors, which carry errors over
+		for i := range strand.channel {
+			strand.channel[i].Clear()
+			dither_reset(&strand.channel[i])
+		}
+		errs = append(errs, ws2811_render(strand))
+	}
+
+	errs = append(errs, ws2811_wait(strand))
+	switch {
+	case strand.simulate: // Nothing to stop
+	case strand.device.driver_mode == PWM:
+		stop_pwm(strand)
+	case strand.device.driver_mode == PCM:
+		pcm := strand.device.pcm
+		for (pcm.Read32(PCM_CS) & RPI_PCM_CS_TXE) == 0 { // Wait till TX FIFO is empty
+		}
+		stop_pcm(strand)
+	}
+
+	errs = append(errs, unmap_registers(strand))
+
+	errs = append(errs, ws2811_cleanup(strand))
+
+	return errors.Join(errs...)
+}
+
+/**
+ * Wait for any executing DMA operation to complete before returning.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error on DMA competion error
+ */
+func ws2811_wait(strand *LEDStrand) error {
+	dma := strand.device.dma
+
+	if strand.device.driver_mode == SPI || strand.simulate { // Nothing to do for SPI
+		return nil
+	}
+
+	for (dma.Read32(DMA_CS)&RPI_DMA_CS_ACTIVE) != 0 &&
+		(dma.Read32(DMA_CS)&RPI_DMA_CS_ERROR) == 0 {
+		strand.clock.Sleep(time.Microsecond * 10)
+	}
+
+	if (dma.Read32(DMA_CS) & RPI_DMA_CS_ERROR) != 0 {
+		return ws2811_errorf(WS2811_ERROR_DMA, "ws2811_wait", "debug %08x", dma.Read32(DMA_DEBUG))
+	}
+
+	return nil
+}
+
+/**
+ * Render the DMA buffer from the user supplied LED arrays and start the DMA
+ * controller.  This will update all LEDs on both PWM channels.
+ *
+ * @param    ws2811  ws2811 instance pointer.
+ *
+ * @returns  nil on success, error otherwise
+ */
+func ws2811_render(strand *LEDStrand) error {
+	pxl_raw := strand.device.pxl_raw
+	driver_mode := strand.device.driver_mode
+	protocol_time := uint32(0)
+
+	dither_track_rate(strand, strand.clock.Now())
+	bits := dither_bits(strand.frame_rate)
+
+	for channum := range strand.channel { // Channel
+		channel := &strand.channel[channum]
+
+		wordpos := channum // PWM & PCM
+		bytepos := 0       // SPI
+		bitpos := 31
+		if driver_mode == SPI {
+			bitpos = 7
+		}
+		scale := uint32(channel.brightness) + 1
+		array_size := 3 // Assume 3 color LEDs, RGB
+
+		// If our shift mask includes the highest nibble, then we have 4 LEDs, RBGW.
+		if (channel.strip_type & SK6812_SHIFT_WMASK) != 0 {
+			array_size = 4
+		}
+
+		// The colors are sent in the order of the shifts, each with the gamma of the
+		// component it is taken from
+		gamma := [LED_COLOURS]*Gamma{
+			channel.gamma[shift_component(channel.rshift)],
+			channel.gamma[shift_component(channel.gshift)],
+			channel.gamma[shift_component(channel.bshift)],
+			channel.gamma[shift_component(channel.wshift)],
+		}
+
+		// 1.25µs per bit
+		channel_protocol_time := uint32(float64(channel.count*array_size*8) * 1.25)
+
+		// Only using the channel which takes the longest as both run in parallel
+		if channel_protocol_time > protocol_time {
+			protocol_time = channel_protocol_time
+		}
+
+		// Derive the white of RGBW strips from red, green and blue
+		white := array_size == 4 && channel.white_mode != WhiteNone
+
+		for i, led := range channel.leds[:channel.count] { // Led
+			var color [LED_COLOURS]byte
+			if channel.dither {
+				color = dither_led(channel, i, gamma, scale, white, bits)
+			} else {
+				if white {
+					led = white_extract(channel.white_mode, channel.white, led)
+				}
+				color = [LED_COLOURS]byte{
+					gamma_correct8(gamma[0], ((uint32(led>>channel.rshift)&0xff)*scale)>>8), // red
+					gamma_correct8(gamma[1], ((uint32(led>>channel.gshift)&0xff)*scale)>>8), // green
+					gamma_correct8(gamma[2], ((uint32(led>>channel.bshift)&0xff)*scale)>>8), // blue
+					gamma_correct8(gamma[3], ((uint32(led>>channel.wshift)&0xff)*scale)>>8), // white
+				}
+			}
+
+			for j := 0; j < array_size; j++ { // Color
+				for k := 7; k >= 0; k-- { // Bit
+					// Inversion is handled by hardware for PWM, otherwise by software here
+					symbol := byte(SYMBOL_LOW)
+					if driver_mode != PWM && channel.invert {
+						symbol = SYMBOL_LOW_INV
+					}
+
+					if (color[j] & (1 << uint(k))) != 0 {
+						symbol = SYMBOL_HIGH
+						if driver_mode != PWM && channel.invert {
+							symbol = SYMBOL_HIGH_INV
+						}
+					}
+
+					for l := 2; l >= 0; l-- { // Symbol
+						if driver_mode == SPI {
+							pxl_raw[bytepos] &^= 1 << uint(bitpos)
+							if (symbol & (1 << uint(l))) != 0 {
+								pxl_raw[bytepos] |= 1 << uint(bitpos)
+							}
+						} else { // PWM & PCM
+							word := binary.LittleEndian.Uint32(pxl_raw[wordpos*4:])
+
+							word &^= 1 << uint(bitpos)
+							if (symbol & (1 << uint(l))) != 0 {
+								word |= 1 << uint(bitpos)
+							}
+
+							binary.LittleEndian.PutUint32(pxl_raw[wordpos*4:], word)
+						}
+
+						bitpos--
+						if bitpos < 0 {
+							if driver_mode == SPI {
+								bytepos++
+								bitpos = 7
+							} else { // PWM & PCM
+								// Every other word is on the same channel for PWM
+								if driver_mode == PWM {
+									wordpos += 2
+								} else {
+									wordpos++
+								}
+								bitpos = 31
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Wait for any previous DMA operation to complete.
+	if err := ws2811_wait(strand); err != nil {
+		return err
+	}
+
+	if strand.render_wait_time != 0 {
+		current_timestamp := get_microsecond_timestamp(strand.clock)
+		time_diff := current_timestamp - strand.previous_timestamp
+
+		if strand.render_wait_time > time_diff {
+			strand.clock.Sleep(time.Duration(strand.render_wait_time-time_diff) * time.Microsecond)
+		}
+	}
+
+	var err error
+	switch {
+	case strand.simulate: // Nothing to send
+	case driver_mode != SPI:
+		dma_start(strand)
+	default:
+		err = spi_transfer(strand)
+	}
+
+	// LED_RESET_WAIT_TIME is added to allow enough time for the reset to occur.
+	strand.previous_timestamp = get_microsecond_timestamp(strand.clock)
+	strand.render_wait_time = uint64(protocol_time) + LED_RESET_WAIT_TIME
+
+	if err != nil {
+		return err
+	}
+	return ws2811_send_frame(strand, strand.clock.Now())
+}
@@ -0,0 +1,265 @@
+package rpiws2811
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * Create a strand of one channel on a fake Pi 3.
+ *
+ * @param    t              test.
+ * @param    gpio           gpio of channel 0, selecting the driver mode.
+ * @param    clear_on_exit  whether the strand is cleared on exit.
+ * @param    opts           further options.
+ *
+ * @returns  the strand, its memory and its VideoCore
+ */
+func fake_strand(t *testing.T, gpio int, clear_on_exit bool, opts ...StrandOption) (*LEDStrand, *FakeMemory, *FakeVideoCore) {
+	t.Helper()
+
+	c1, err := NewLEDStrandChannel(gpio, 4, 255, false, WS2811_STRIP_GRB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strand, mem, vc, err := fake_strand_channels(c1, LEDStrandChannel{}, clear_on_exit, opts...)
+	if err != nil {
+		t.Fatalf("NewLEDStrand: %v", err)
+	}
+	return strand, mem, vc
+}
+
+/**
+ * Create a strand of two channels on a fake Pi 3, or the board of the
+ * cpuinfo given in opts.
+ *
+ * @param    c1             channel 0.
+ * @param    c2             channel 1.
+ * @param    clear_on_exit  whether the strand is cleared on exit.
+ * @param    opts           further options.
+ *
+ * @returns  the strand, its memory and its VideoCore, error if NewLEDStrand fails
+ */
+func fake_strand_channels(c1, c2 LEDStrandChannel, clear_on_exit bool, opts ...StrandOption) (*LEDStrand, *FakeMemory, *FakeVideoCore, error) {
+	mem := NewFakeMemory(PERIPH_BASE_RPI2)
+	vc := NewFakeVideoCore()
+	opts = append([]StrandOption{
+		WithCPUInfo("testdata/cpuinfo/pi3b"),
+		WithDeviceTree(""),
+		WithPeripheralMemory(mem),
+		WithVideoCore(vc),
+		WithClock(NewFakeClock(time.Unix(0, 0))),
+	}, opts...)
+	strand, err := NewLEDStrand(WS2811_TARGET_FREQ, 10, clear_on_exit, c1, c2, opts...)
+	return strand, mem, vc, err
+}
+
+/**
+ * Keep the writes to the registers of interest, in order.
+ *
+ * @param    writes  register writes.
+ * @param    names   name of each register of interest by its physical address.
+ *
+ * @returns  the writes to those registers
+ */
+func filter_writes(writes []RegisterWrite, names map[uint32]string) []RegisterWrite {
+	var kept []RegisterWrite
+	for _, write := range writes {
+		if _, ok := names[write.Addr]; ok {
+			kept = append(kept, write)
+		}
+	}
+	return kept
+}
+
+func check_writes(t *testing.T, got []RegisterWrite, want []RegisterWrite, names map[uint32]string) {
+	t.Helper()
+
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			t.Errorf("write %v: missing %v = %#08x", i, names[want[i].Addr], want[i].Value)
+		case i >= len(want):
+			t.Errorf("write %v: unexpected %v = %#08x", i, names[got[i].Addr], got[i].Value)
+		case got[i] != want[i]:
+			t.Errorf("write %v: %v = %#08x, want %v = %#08x", i, names[got[i].Addr], got[i].Value, names[want[i].Addr], want[i].Value)
+		}
+	}
+}
+
+func TestPWMRegisterWrites(t *testing.T) {
+	strand, mem, vc := fake_strand(t, 18, false)
+
+	base := uint32(PERIPH_BASE_RPI2)
+	cm_ctl := base + CM_PWM_OFFSET + uint32(CM_CLK_CTL)
+	cm_div := base + CM_PWM_OFFSET + uint32(CM_CLK_DIV)
+	pwm_ctl := base + PWM_OFFSET + uint32(PWM_CTL)
+	pwm_rng1 := base + PWM_OFFSET + uint32(PWM_RNG1)
+	pwm_dmac := base + PWM_OFFSET + uint32(PWM_DMAC)
+	dma_cs := base + dmanum_to_offset(10) + uint32(DMA_CS)
+	dma_conblk_ad := base + dmanum_to_offset(10) + uint32(DMA_CONBLK_AD)
+	names := map[uint32]string{
+		cm_ctl:        "CM_PWMCTL",
+		cm_div:        "CM_PWMDIV",
+		pwm_ctl:       "PWM CTL",
+		pwm_rng1:      "PWM RNG1",
+		pwm_dmac:      "PWM DMAC",
+		dma_cs:        "DMA CS",
+		dma_conblk_ad: "DMA CONBLK_AD",
+	}
+	ctl := RPI_PWM_CTL_USEF1 | RPI_PWM_CTL_MODE1 | RPI_PWM_CTL_USEF2 | RPI_PWM_CTL_MODE2
+
+	// 19.2 MHz / 3 clocks per symbol / 800 kHz
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{pwm_ctl, 0},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL},
+		{cm_div, CM_CLK_DIV_PASSWD | CM_CLK_DIV_DIVI(8)},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC | CM_CLK_CTL_ENAB},
+		{pwm_rng1, 32},
+		{pwm_ctl, RPI_PWM_CTL_CLRF1},
+		{pwm_dmac, RPI_PWM_DMAC_ENAB | RPI_PWM_DMAC_PANIC(7) | RPI_PWM_DMAC_DREQ(3)},
+		{pwm_ctl, ctl},
+		{pwm_ctl, ctl | RPI_PWM_CTL_PWEN1 | RPI_PWM_CTL_PWEN2},
+		{dma_cs, 0},
+	}, names)
+
+	mem.ClearWrites()
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{dma_cs, RPI_DMA_CS_RESET},
+		{dma_cs, RPI_DMA_CS_INT | RPI_DMA_CS_END},
+		{dma_conblk_ad, strand.device.dma_cb_addr},
+		{dma_cs, RPI_DMA_CS_WAIT_OUTSTANDING_WRITES | RPI_DMA_CS_PANIC_PRIORITY(15) | RPI_DMA_CS_PRIORITY(15) | RPI_DMA_CS_ACTIVE},
+	}, names)
+
+	mem.ClearWrites()
+	if err := strand.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{pwm_ctl, 0},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL},
+	}, names)
+
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Close", n)
+	}
+	vc.Check(t)
+}
+
+func TestPCMRegisterWrites(t *testing.T) {
+	strand, mem, vc := fake_strand(t, 21, false)
+
+	base := uint32(PERIPH_BASE_RPI2)
+	cm_ctl := base + CM_PCM_OFFSET + uint32(CM_CLK_CTL)
+	cm_div := base + CM_PCM_OFFSET + uint32(CM_CLK_DIV)
+	pcm_cs := base + PCM_OFFSET + uint32(PCM_CS)
+	pcm_mode := base + PCM_OFFSET + uint32(PCM_MODE)
+	pcm_txc := base + PCM_OFFSET + uint32(PCM_TXC)
+	pcm_dreq := base + PCM_OFFSET + uint32(PCM_DREQ)
+	dma_cs := base + dmanum_to_offset(10) + uint32(DMA_CS)
+	dma_conblk_ad := base + dmanum_to_offset(10) + uint32(DMA_CONBLK_AD)
+	names := map[uint32]string{
+		cm_ctl:        "CM_PCMCTL",
+		cm_div:        "CM_PCMDIV",
+		pcm_cs:        "PCM CS",
+		pcm_mode:      "PCM MODE",
+		pcm_txc:       "PCM TXC",
+		pcm_dreq:      "PCM DREQ",
+		dma_cs:        "DMA CS",
+		dma_conblk_ad: "DMA CONBLK_AD",
+	}
+	// The emulated TX FIFO is always empty, so TXE reads back into reg_set
+	cs := uint32(RPI_PCM_CS_EN | RPI_PCM_CS_TXE)
+
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{pcm_cs, 0},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL},
+		{cm_div, CM_CLK_DIV_PASSWD | CM_CLK_DIV_DIVI(8)},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_SRC_OSC | CM_CLK_CTL_ENAB},
+		{pcm_cs, RPI_PCM_CS_EN},
+		{pcm_mode, RPI_PCM_MODE_FLEN(31) | RPI_PCM_MODE_FSLEN(1)},
+		{pcm_txc, RPI_PCM_TXC_CH1WEX | RPI_PCM_TXC_CH1EN | RPI_PCM_TXC_CH1POS(0) | RPI_PCM_TXC_CH1WID(8)},
+		{pcm_cs, cs | RPI_PCM_CS_TXCLR},
+		{pcm_cs, cs | RPI_PCM_CS_DMAEN},
+		{pcm_dreq, RPI_PCM_DREQ_TX(0x3F) | RPI_PCM_DREQ_TX_PANIC(0x10)},
+		{dma_cs, 0},
+	}, names)
+
+	mem.ClearWrites()
+	if err := strand.Render(); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{dma_cs, RPI_DMA_CS_RESET},
+		{dma_cs, RPI_DMA_CS_INT | RPI_DMA_CS_END},
+		{dma_conblk_ad, strand.device.dma_cb_addr},
+		{dma_cs, RPI_DMA_CS_WAIT_OUTSTANDING_WRITES | RPI_DMA_CS_PANIC_PRIORITY(15) | RPI_DMA_CS_PRIORITY(15) | RPI_DMA_CS_ACTIVE},
+		{pcm_cs, cs | RPI_PCM_CS_DMAEN | RPI_PCM_CS_TXON},
+	}, names)
+
+	mem.ClearWrites()
+	if err := strand.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	check_writes(t, filter_writes(mem.Writes(), names), []RegisterWrite{
+		{pcm_cs, 0},
+		{cm_ctl, CM_CLK_CTL_PASSWD | CM_CLK_CTL_KILL},
+	}, names)
+
+	if n := mem.Mapped(); n != 0 {
+		t.Errorf("%v ranges still mapped after Close", n)
+	}
+	vc.Check(t)
+}
+
+func TestDriverModeRejections(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuinfo string
+		gpio1   int // gpio of channel 0, 0 with no LEDs
+		gpio2   int // gpio of channel 1, 0 with no LEDs
+		want    string
+	}{
+		{"PCM with a second channel", "pi3b", 21, 13, "drives a single channel"},
+		{"SPI with a second channel", "pi3b", 10, 13, "drives a single channel"},
+		{"channel 1 on PWM0", "pi3b", 18, 12, "LED channel 1 can use"},
+		{"channel 1 alone on PWM0", "pi3b", 0, 18, "LED channel 1 can use"},
+		{"PWM0 on GPIO 12 of a rev 1", "pi1b-rev1", 12, 0, "isn't broken out"},
+		{"PWM1 of a rev 1", "pi1b-rev1", 18, 13, "has no PWM1 pin"},
+	}
+
+	for _, test := range tests {
+		var channels [2]LEDStrandChannel
+		for i, gpio := range []int{test.gpio1, test.gpio2} {
+			if gpio == 0 {
+				continue
+			}
+			channel, err := NewLEDStrandChannel(gpio, 4, 255, false, WS2811_STRIP_GRB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			channels[i] = channel
+		}
+
+		strand, mem, vc, err := fake_strand_channels(channels[0], channels[1], false,
+			WithCPUInfo("testdata/cpuinfo/"+test.cpuinfo))
+		if err == nil {
+			strand.Close()
+			t.Errorf("%v: NewLEDStrand succeeded", test.name)
+		} else if !errors.Is(err, ErrIllegalGPIO) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: error %v, want ErrIllegalGPIO with %q", test.name, err, test.want)
+		}
+
+		if n := mem.Mapped(); n != 0 {
+			t.Errorf("%v: %v ranges still mapped", test.name, n)
+		}
+		vc.Check(t)
+	}
+}